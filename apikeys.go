@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/deoreal/chirpy/internal/auth"
+	"github.com/deoreal/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Scopes an API key can be granted. Access tokens from a password login
+// carry every scope.
+const (
+	scopeChirpsRead  = "chirps:read"
+	scopeChirpsWrite = "chirps:write"
+	scopeUsersRead   = "users:read"
+)
+
+var apiKeyScopes = []string{scopeChirpsRead, scopeChirpsWrite, scopeUsersRead}
+
+const maxAPIKeyNameLen = 100
+
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Key        string     `json:"key,omitempty"`
+}
+
+func apiKeyFromDB(k database.ApiKey) APIKey {
+	key := APIKey{ID: k.ID, CreatedAt: k.CreatedAt, Name: k.Name, Prefix: k.KeyPrefix, Scopes: k.Scopes}
+	if k.LastUsedAt.Valid {
+		key.LastUsedAt = &k.LastUsedAt.Time
+	}
+	return key
+}
+
+// normalizeScopes checks requested scopes against apiKeyScopes and returns
+// them sorted and de-duplicated. It reports the first unknown scope.
+func normalizeScopes(scopes []string) ([]string, string, bool) {
+	if len(scopes) == 0 {
+		return nil, "", false
+	}
+	out := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		s = strings.TrimSpace(s)
+		if !slices.Contains(apiKeyScopes, s) {
+			return nil, s, false
+		}
+		out = append(out, s)
+	}
+	slices.Sort(out)
+
+	return slices.Compact(out), "", true
+}
+
+// middlewareScopedAuth accepts either a bearer access token or an
+// "Authorization: ApiKey" key granted scope. Bearer tokens are handed to
+// middlewareTokenAuth unchanged.
+func (cfg *apiConfig) middlewareScopedAuth(scope string, next http.HandlerFunc) http.HandlerFunc {
+	tokenAuth := cfg.middlewareTokenAuth(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, err := auth.GetAPIKey(r.Header)
+		if err != nil {
+			tokenAuth.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, ok := cfg.authenticateAPIKey(w, r, key, scope)
+		if !ok {
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticateAPIKey looks up key and checks it was granted scope,
+// returning a context carrying its owner's user ID. On failure it writes
+// the 401 or 403 response itself.
+func (cfg *apiConfig) authenticateAPIKey(w http.ResponseWriter, r *http.Request, key, scope string) (context.Context, bool) {
+	apiKey, err := cfg.dbQueries.GetAPIKeyByHash(r.Context(), auth.HashAPIKey(key))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error db query %s", err)
+		}
+		w.WriteHeader(401)
+		js, _ := json.Marshal(jsonError{Error: "Unauthorized"})
+		w.Write(js)
+		return nil, false
+	}
+
+	if !slices.Contains(apiKey.Scopes, scope) {
+		w.WriteHeader(403)
+		js, _ := json.Marshal(jsonError{Error: "API key is missing scope " + scope})
+		w.Write(js)
+		return nil, false
+	}
+
+	if err := cfg.dbQueries.TouchAPIKey(r.Context(), apiKey.ID); err != nil {
+		log.Printf("Error recording api key use %s", err)
+	}
+
+	return context.WithValue(r.Context(), userIDKey, apiKey.UserID), true
+}
+
+// createAPIKey mints a key for the caller. The key is only ever returned
+// here; afterwards only its prefix is shown.
+func (cfg *apiConfig) createAPIKey(w http.ResponseWriter, req *http.Request) {
+	type createRequest struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+
+	userID, _ := userIDFromContext(req.Context())
+
+	var cr createRequest
+	decoder := json.NewDecoder(req.Body)
+	err := decoder.Decode(&cr)
+	cr.Name = strings.TrimSpace(cr.Name)
+	if err != nil || cr.Name == "" || len(cr.Name) > maxAPIKeyNameLen {
+		log.Printf("Error decoding json parameters: %v", err)
+		w.WriteHeader(400)
+		js, _ := json.Marshal(jsonError{Error: "Invalid request body"})
+		w.Write(js)
+		return
+	}
+
+	scopes, unknown, ok := normalizeScopes(cr.Scopes)
+	if !ok {
+		msg := "At least one scope is required"
+		if unknown != "" {
+			msg = "Unknown scope " + unknown
+		}
+		w.WriteHeader(400)
+		js, _ := json.Marshal(jsonError{Error: msg})
+		w.Write(js)
+		return
+	}
+
+	key, prefix, hash, err := auth.MakeAPIKey()
+	if err != nil {
+		log.Printf("Error creating api key %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	dbKey, err := cfg.dbQueries.CreateAPIKey(req.Context(), database.CreateAPIKeyParams{
+		UserID:    userID,
+		Name:      cr.Name,
+		KeyPrefix: prefix,
+		KeyHash:   hash,
+		Scopes:    scopes,
+	})
+	if err != nil {
+		log.Printf("Error storing api key %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	resp := apiKeyFromDB(dbKey)
+	resp.Key = key
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(201)
+	js, _ := json.Marshal(resp)
+	w.Write(js)
+}
+
+func (cfg *apiConfig) listAPIKeys(w http.ResponseWriter, req *http.Request) {
+	userID, _ := userIDFromContext(req.Context())
+
+	dbKeys, err := cfg.dbQueries.ListAPIKeys(req.Context(), userID)
+	if err != nil {
+		log.Printf("Error db query %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	keys := make([]APIKey, 0, len(dbKeys))
+	for _, k := range dbKeys {
+		keys = append(keys, apiKeyFromDB(k))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	js, _ := json.Marshal(keys)
+	w.Write(js)
+}
+
+func (cfg *apiConfig) revokeAPIKey(w http.ResponseWriter, req *http.Request) {
+	userID, _ := userIDFromContext(req.Context())
+
+	keyID, err := uuid.Parse(req.PathValue("keyID"))
+	if err != nil {
+		w.WriteHeader(404)
+		js, _ := json.Marshal(jsonError{Error: "API key not found"})
+		w.Write(js)
+		return
+	}
+
+	n, err := cfg.dbQueries.RevokeAPIKey(req.Context(), database.RevokeAPIKeyParams{ID: keyID, UserID: userID})
+	if err != nil {
+		log.Printf("Error revoking api key %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+	if n == 0 {
+		w.WriteHeader(404)
+		js, _ := json.Marshal(jsonError{Error: "API key not found"})
+		w.Write(js)
+		return
+	}
+
+	w.WriteHeader(204)
+}
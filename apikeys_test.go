@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestNormalizeScopes(t *testing.T) {
+	tests := []struct {
+		name        string
+		scopes      []string
+		want        []string
+		wantUnknown string
+		wantOK      bool
+	}{
+		{name: "empty", scopes: nil},
+		{name: "single", scopes: []string{"chirps:read"}, want: []string{"chirps:read"}, wantOK: true},
+		{
+			name:   "sorted and deduplicated",
+			scopes: []string{"users:read", "chirps:write", " users:read "},
+			want:   []string{"chirps:write", "users:read"},
+			wantOK: true,
+		},
+		{name: "unknown", scopes: []string{"chirps:read", "admin"}, wantUnknown: "admin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, unknown, ok := normalizeScopes(tt.scopes)
+			if ok != tt.wantOK || unknown != tt.wantUnknown || !slices.Equal(got, tt.want) {
+				t.Errorf("normalizeScopes(%q) = %q, %q, %v; want %q, %q, %v",
+					tt.scopes, got, unknown, ok, tt.want, tt.wantUnknown, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestMiddlewareScopedAuthAcceptsBearer(t *testing.T) {
+	keys, err := loadKeyring("", "", "", "test_secret_key")
+	if err != nil {
+		t.Fatalf("loadKeyring() error = %v", err)
+	}
+	cfg := &apiConfig{JWTKeys: keys}
+
+	userID := uuid.New()
+	token, err := keys.MakeJWT(userID, "user", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+
+	var got uuid.UUID
+	h := cfg.middlewareScopedAuth(scopeChirpsWrite, func(w http.ResponseWriter, r *http.Request) {
+		got, _ = userIDFromContext(r.Context())
+		w.WriteHeader(204)
+	})
+
+	req := httptest.NewRequest("POST", "/api/chirps", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != 204 || got != userID {
+		t.Errorf("status = %d, user = %v; want 204, %v", rec.Code, got, userID)
+	}
+
+	req = httptest.NewRequest("POST", "/api/chirps", nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != 401 {
+		t.Errorf("status without credentials = %d, want 401", rec.Code)
+	}
+}
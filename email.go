@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/deoreal/chirpy/internal/auth"
+	"github.com/deoreal/chirpy/internal/database"
+	"github.com/deoreal/chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+// Single-use email tokens are JWTs scoped to one purpose by their
+// audience. Their IDs are stored in one_time_tokens together with the
+// address they were sent to, and marked used on redemption.
+const (
+	purposeVerifyEmail   = "chirpy-verify-email"
+	purposePasswordReset = "chirpy-password-reset"
+
+	verifyEmailExpiry   = 24 * time.Hour
+	passwordResetExpiry = time.Hour
+)
+
+// Emailed links open these pages under /app/, which post the token to
+// POST /api/users/verify and POST /api/password-reset/confirm.
+const (
+	verifyEmailPage   = "/app/verify.html"
+	resetPasswordPage = "/app/reset-password.html"
+)
+
+// loadMailer picks the mail transport: SMTP when SMTP_ADDR is set, .eml
+// files in MAIL_DIR for development, and the server log otherwise.
+func loadMailer(getenv func(string) string) mailer.Mailer {
+	from := getenv("MAIL_FROM")
+	if from == "" {
+		from = "Chirpy <no-reply@chirpy.local>"
+	}
+
+	switch {
+	case getenv("SMTP_ADDR") != "":
+		return mailer.SMTPMailer{
+			Addr:     getenv("SMTP_ADDR"),
+			From:     from,
+			Username: getenv("SMTP_USERNAME"),
+			Password: getenv("SMTP_PASSWORD"),
+		}
+	case getenv("MAIL_DIR") != "":
+		return mailer.FileMailer{Dir: getenv("MAIL_DIR"), From: from}
+	default:
+		return mailer.LogMailer{}
+	}
+}
+
+func (cfg *apiConfig) issueOneTimeToken(ctx context.Context, user database.User, purpose string, expiresIn time.Duration) (string, error) {
+	token, id, err := cfg.JWTKeys.MakeOneTimeJWT(user.ID, purpose, expiresIn)
+	if err != nil {
+		return "", err
+	}
+
+	err = cfg.dbQueries.CreateOneTimeToken(ctx, database.CreateOneTimeTokenParams{
+		ID:        id,
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Email:     user.Email,
+		ExpiresAt: time.Now().UTC().Add(expiresIn),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// redeemOneTimeToken verifies token and marks it used. It fails if the
+// token was already used, has expired or was issued for another purpose.
+func (cfg *apiConfig) redeemOneTimeToken(ctx context.Context, token, purpose string) (database.OneTimeToken, error) {
+	userID, id, err := cfg.JWTKeys.ValidateOneTimeJWT(token, purpose)
+	if err != nil {
+		return database.OneTimeToken{}, err
+	}
+
+	ott, err := cfg.dbQueries.UseOneTimeToken(ctx, database.UseOneTimeTokenParams{ID: id, Purpose: purpose})
+	if err != nil {
+		return database.OneTimeToken{}, err
+	}
+	if ott.UserID != userID {
+		return database.OneTimeToken{}, fmt.Errorf("token subject does not match")
+	}
+
+	return ott, nil
+}
+
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, user database.User) error {
+	token, err := cfg.issueOneTimeToken(ctx, user, purposeVerifyEmail, verifyEmailExpiry)
+	if err != nil {
+		return err
+	}
+
+	link := cfg.BaseURL + verifyEmailPage + "?token=" + url.QueryEscape(token)
+	return cfg.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your Chirpy email address",
+		Body:    fmt.Sprintf("Confirm your email address by opening this link within 24 hours:\n\n%s\n", link),
+	})
+}
+
+// requireVerifiedEmail writes an error and returns false if
+// RequireVerifiedEmail is set and userID has not confirmed their email
+// address. Every handler that posts to timelines checks it.
+func (cfg *apiConfig) requireVerifiedEmail(w http.ResponseWriter, req *http.Request, userID uuid.UUID) bool {
+	if !cfg.RequireVerifiedEmail {
+		return true
+	}
+	user, err := cfg.dbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting user: %s", err)
+		w.WriteHeader(401)
+		js, _ := json.Marshal(jsonError{Error: "Unauthorized"})
+		w.Write(js)
+		return false
+	}
+	if !user.EmailVerifiedAt.Valid {
+		w.WriteHeader(403)
+		js, _ := json.Marshal(jsonError{Error: "Email address not verified"})
+		w.Write(js)
+		return false
+	}
+	return true
+}
+
+func (cfg *apiConfig) resendVerification(w http.ResponseWriter, req *http.Request) {
+	userID, _ := userIDFromContext(req.Context())
+
+	user, err := cfg.dbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting user: %s", err)
+		w.WriteHeader(401)
+		js, _ := json.Marshal(jsonError{Error: "Unauthorized"})
+		w.Write(js)
+		return
+	}
+	if user.EmailVerifiedAt.Valid {
+		w.WriteHeader(409)
+		js, _ := json.Marshal(jsonError{Error: "Email address already verified"})
+		w.Write(js)
+		return
+	}
+
+	err = cfg.sendVerificationEmail(req.Context(), user)
+	if err != nil {
+		log.Printf("Error sending verification email %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	w.WriteHeader(202)
+}
+
+func (cfg *apiConfig) verifyEmail(w http.ResponseWriter, req *http.Request) {
+	type verifyRequest struct {
+		Token string `json:"token"`
+	}
+
+	var vr verifyRequest
+	decoder := json.NewDecoder(req.Body)
+	err := decoder.Decode(&vr)
+	if err != nil || vr.Token == "" {
+		log.Printf("Error decoding json parameters: %v", err)
+		w.WriteHeader(400)
+		js, _ := json.Marshal(jsonError{Error: "Invalid request body"})
+		w.Write(js)
+		return
+	}
+
+	ott, err := cfg.redeemOneTimeToken(req.Context(), vr.Token, purposeVerifyEmail)
+	if err != nil {
+		log.Printf("Invalid verification token %s", err)
+		w.WriteHeader(401)
+		js, _ := json.Marshal(jsonError{Error: "Invalid or expired token"})
+		w.Write(js)
+		return
+	}
+
+	// The address may have changed since the link was sent.
+	n, err := cfg.dbQueries.MarkEmailVerified(req.Context(), database.MarkEmailVerifiedParams{ID: ott.UserID, Email: ott.Email})
+	if err != nil {
+		log.Printf("Error verifying email %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+	if n == 0 {
+		w.WriteHeader(409)
+		js, _ := json.Marshal(jsonError{Error: "Email address has changed"})
+		w.Write(js)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// requestPasswordReset always answers 202 so it cannot be used to find out
+// which addresses have accounts.
+func (cfg *apiConfig) requestPasswordReset(w http.ResponseWriter, req *http.Request) {
+	type resetRequest struct {
+		Email string `json:"email"`
+	}
+
+	var rr resetRequest
+	decoder := json.NewDecoder(req.Body)
+	err := decoder.Decode(&rr)
+	if err != nil || rr.Email == "" {
+		log.Printf("Error decoding json parameters: %v", err)
+		w.WriteHeader(400)
+		js, _ := json.Marshal(jsonError{Error: "Invalid request body"})
+		w.Write(js)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUser(req.Context(), rr.Email)
+	if err != nil {
+		log.Printf("Password reset for unknown email: %s", err)
+		w.WriteHeader(202)
+		return
+	}
+
+	token, err := cfg.issueOneTimeToken(req.Context(), user, purposePasswordReset, passwordResetExpiry)
+	if err == nil {
+		link := cfg.BaseURL + resetPasswordPage + "?token=" + url.QueryEscape(token)
+		err = cfg.Mailer.Send(req.Context(), mailer.Message{
+			To:      user.Email,
+			Subject: "Reset your Chirpy password",
+			Body:    fmt.Sprintf("Choose a new password by opening this link within one hour:\n\n%s\n\nIf you did not ask for this, ignore this email.\n", link),
+		})
+	}
+	if err != nil {
+		log.Printf("Error sending password reset email %s", err)
+	}
+
+	w.WriteHeader(202)
+}
+
+func (cfg *apiConfig) confirmPasswordReset(w http.ResponseWriter, req *http.Request) {
+	type confirmRequest struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	var cr confirmRequest
+	decoder := json.NewDecoder(req.Body)
+	err := decoder.Decode(&cr)
+	if err != nil || cr.Token == "" {
+		log.Printf("Error decoding json parameters: %v", err)
+		w.WriteHeader(400)
+		js, _ := json.Marshal(jsonError{Error: "Invalid request body"})
+		w.Write(js)
+		return
+	}
+	if !cfg.checkPasswordPolicy(w, cr.Password) {
+		return
+	}
+
+	ott, err := cfg.redeemOneTimeToken(req.Context(), cr.Token, purposePasswordReset)
+	if err != nil {
+		log.Printf("Invalid password reset token %s", err)
+		w.WriteHeader(401)
+		js, _ := json.Marshal(jsonError{Error: "Invalid or expired token"})
+		w.Write(js)
+		return
+	}
+
+	pw, err := auth.HashPassword(cr.Password)
+	if err != nil {
+		log.Printf("Error hashing password %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	// The link must have been sent to the account's current address, or
+	// whoever controlled an old address could take the account over.
+	n, err := cfg.dbQueries.ResetUserPassword(req.Context(), database.ResetUserPasswordParams{
+		ID:             ott.UserID,
+		Email:          ott.Email,
+		HashedPassword: pw,
+	})
+	if err == nil && n > 0 {
+		// Anyone holding the old password may also be logged in.
+		err = cfg.revokeAllSessions(req.Context(), ott.UserID)
+	}
+	if err != nil {
+		log.Printf("Error resetting password %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+	if n == 0 {
+		w.WriteHeader(409)
+		js, _ := json.Marshal(jsonError{Error: "Email address has changed"})
+		w.Write(js)
+		return
+	}
+	cfg.clearLoginFailures(req.Context(), ott.Email)
+
+	w.WriteHeader(204)
+}
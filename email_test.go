@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deoreal/chirpy/internal/auth"
+	"github.com/deoreal/chirpy/internal/database"
+	"github.com/deoreal/chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+func TestLoadMailer(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{name: "smtp", env: map[string]string{"SMTP_ADDR": "smtp.example.com:587", "MAIL_DIR": "/tmp"}, want: "mailer.SMTPMailer"},
+		{name: "file", env: map[string]string{"MAIL_DIR": "/tmp/mail"}, want: "mailer.FileMailer"},
+		{name: "log", env: map[string]string{}, want: "mailer.LogMailer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := loadMailer(func(k string) string { return tt.env[k] })
+			var got string
+			switch m.(type) {
+			case mailer.SMTPMailer:
+				got = "mailer.SMTPMailer"
+			case mailer.FileMailer:
+				got = "mailer.FileMailer"
+			case mailer.LogMailer:
+				got = "mailer.LogMailer"
+			}
+			if got != tt.want {
+				t.Errorf("loadMailer() = %T, want %s", m, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmailLinkPagesExist(t *testing.T) {
+	fs := http.StripPrefix("/app", http.FileServer(http.Dir("./")))
+	for _, page := range []string{verifyEmailPage, resetPasswordPage} {
+		rec := httptest.NewRecorder()
+		fs.ServeHTTP(rec, httptest.NewRequest("GET", page+"?token=x", nil))
+		if rec.Code != 200 {
+			t.Errorf("GET %s status = %d, want 200", page, rec.Code)
+		}
+	}
+}
+
+func TestVerifyEmailRejectsWrongPurpose(t *testing.T) {
+	keys, err := loadKeyring("", "", "", "test_secret_key")
+	if err != nil {
+		t.Fatalf("loadKeyring() error = %v", err)
+	}
+	cfg := &apiConfig{JWTKeys: keys}
+
+	// A password reset token must not verify an email address.
+	token, _, err := keys.MakeOneTimeJWT(uuid.New(), purposePasswordReset, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeOneTimeJWT() error = %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/api/users/verify", strings.NewReader(`{"token":"`+token+`"}`))
+	rec := httptest.NewRecorder()
+	cfg.verifyEmail(rec, req)
+
+	if rec.Code != 401 {
+		t.Errorf("status = %d, want 401", rec.Code)
+	}
+}
+
+func TestConfirmPasswordResetEnforcesPolicy(t *testing.T) {
+	cfg := &apiConfig{PasswordPolicy: auth.DefaultPasswordPolicy}
+
+	req := httptest.NewRequest("POST", "/api/password-reset/confirm", strings.NewReader(`{"token":"x","password":"short"}`))
+	rec := httptest.NewRecorder()
+	cfg.confirmPasswordReset(rec, req)
+
+	if rec.Code != 422 {
+		t.Errorf("status = %d, want 422", rec.Code)
+	}
+}
+
+func TestConfirmPasswordResetRequiresCurrentEmail(t *testing.T) {
+	cfg := newDBConfig(t)
+	cfg.PasswordPolicy = auth.DefaultPasswordPolicy
+	keys, err := loadKeyring("", "", "", "test_secret_key")
+	if err != nil {
+		t.Fatalf("loadKeyring() error = %v", err)
+	}
+	cfg.JWTKeys = keys
+	ctx := context.Background()
+
+	userID := createTestUser(t, cfg, "alice@example.com")
+	user, err := cfg.dbQueries.GetUserByID(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetUserByID() error = %v", err)
+	}
+	stale, err := cfg.issueOneTimeToken(ctx, user, purposePasswordReset, passwordResetExpiry)
+	if err != nil {
+		t.Fatalf("issueOneTimeToken() error = %v", err)
+	}
+	user, err = cfg.dbQueries.UpdateUser(ctx, database.UpdateUserParams{ID: userID, Email: "alice@example.net", HashedPassword: "x"})
+	if err != nil {
+		t.Fatalf("UpdateUser() error = %v", err)
+	}
+	current, err := cfg.issueOneTimeToken(ctx, user, purposePasswordReset, passwordResetExpiry)
+	if err != nil {
+		t.Fatalf("issueOneTimeToken() error = %v", err)
+	}
+
+	confirm := func(token string) int {
+		rec := httptest.NewRecorder()
+		body := `{"token":"` + token + `","password":"correct horse battery staple"}`
+		cfg.confirmPasswordReset(rec, httptest.NewRequest("POST", "/api/password-reset/confirm", strings.NewReader(body)))
+		return rec.Code
+	}
+	if code := confirm(stale); code != 409 {
+		t.Errorf("reset with a link sent to the old address status = %d, want 409", code)
+	}
+	if user, _ := cfg.dbQueries.GetUserByID(ctx, userID); user.HashedPassword != "x" {
+		t.Error("reset with a link sent to the old address changed the password")
+	}
+	if code := confirm(current); code != 204 {
+		t.Errorf("reset with a link sent to the current address status = %d, want 204", code)
+	}
+}
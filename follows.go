@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/deoreal/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type Follow struct {
+	UserID     uuid.UUID `json:"user_id"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+type followPage struct {
+	Users      []Follow `json:"users"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// followTarget returns the user named by the userID path value, writing a
+// 404 if it is malformed.
+func followTarget(w http.ResponseWriter, req *http.Request) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		w.WriteHeader(404)
+		js, _ := json.Marshal(jsonError{Error: "User not found"})
+		w.Write(js)
+		return uuid.UUID{}, false
+	}
+	return userID, true
+}
+
+// followUser is idempotent: following someone twice is not an error.
+func (cfg *apiConfig) followUser(w http.ResponseWriter, req *http.Request) {
+	followerID, _ := userIDFromContext(req.Context())
+	followeeID, ok := followTarget(w, req)
+	if !ok {
+		return
+	}
+	if followeeID == followerID {
+		w.WriteHeader(400)
+		js, _ := json.Marshal(jsonError{Error: "You cannot follow yourself"})
+		w.Write(js)
+		return
+	}
+
+	err := cfg.follow(req.Context(), followerID, followeeID)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			w.WriteHeader(404)
+			js, _ := json.Marshal(jsonError{Error: "User not found"})
+			w.Write(js)
+			return
+		}
+		log.Printf("Error following user %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// unfollowUser is idempotent like followUser.
+func (cfg *apiConfig) unfollowUser(w http.ResponseWriter, req *http.Request) {
+	followerID, _ := userIDFromContext(req.Context())
+	followeeID, ok := followTarget(w, req)
+	if !ok {
+		return
+	}
+
+	err := cfg.unfollow(req.Context(), followerID, followeeID)
+	if err != nil {
+		log.Printf("Error unfollowing user %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// follow records the follow and bumps the followee's follower count in one
+// transaction, then drops the follower's cached timeline so that it is
+// rebuilt with the new followee's chirps.
+func (cfg *apiConfig) follow(ctx context.Context, followerID, followeeID uuid.UUID) error {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	rows, err := qtx.FollowUser(ctx, database.FollowUserParams{FollowerID: followerID, FolloweeID: followeeID})
+	if err != nil {
+		return err
+	}
+	if rows == 1 {
+		if err := qtx.IncrementFollowerCount(ctx, followeeID); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if cfg.Timelines != nil {
+		cfg.Timelines.Drop(followerID)
+	}
+	return nil
+}
+
+func (cfg *apiConfig) unfollow(ctx context.Context, followerID, followeeID uuid.UUID) error {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	rows, err := qtx.UnfollowUser(ctx, database.UnfollowUserParams{FollowerID: followerID, FolloweeID: followeeID})
+	if err != nil {
+		return err
+	}
+	if rows == 1 {
+		if err := qtx.DecrementFollowerCount(ctx, followeeID); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if cfg.Timelines != nil {
+		cfg.Timelines.Drop(followerID)
+	}
+	return nil
+}
+
+func (cfg *apiConfig) listFollowers(w http.ResponseWriter, req *http.Request) {
+	cfg.listFollows(w, req, func(args database.ListFollowersParams) ([]Follow, error) {
+		rows, err := cfg.dbQueries.ListFollowers(req.Context(), args)
+		follows := make([]Follow, 0, len(rows))
+		for _, r := range rows {
+			follows = append(follows, Follow{UserID: r.UserID, FollowedAt: r.CreatedAt})
+		}
+		return follows, err
+	})
+}
+
+func (cfg *apiConfig) listFollowing(w http.ResponseWriter, req *http.Request) {
+	cfg.listFollows(w, req, func(args database.ListFollowersParams) ([]Follow, error) {
+		rows, err := cfg.dbQueries.ListFollowing(req.Context(), database.ListFollowingParams(args))
+		follows := make([]Follow, 0, len(rows))
+		for _, r := range rows {
+			follows = append(follows, Follow{UserID: r.UserID, FollowedAt: r.CreatedAt})
+		}
+		return follows, err
+	})
+}
+
+// listFollows writes one page of a follower or following listing, newest
+// first.
+func (cfg *apiConfig) listFollows(w http.ResponseWriter, req *http.Request, list func(database.ListFollowersParams) ([]Follow, error)) {
+	userID, ok := followTarget(w, req)
+	if !ok {
+		return
+	}
+	limit, cursor, err := parsePageParams(req.URL.Query())
+	if err != nil {
+		w.WriteHeader(400)
+		js, _ := json.Marshal(jsonError{Error: err.Error()})
+		w.Write(js)
+		return
+	}
+
+	// Fetch one extra row to learn whether another page follows.
+	args := database.ListFollowersParams{UserID: userID, RowLimit: limit + 1}
+	if cursor != nil {
+		args.CursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		args.CursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+	follows, err := list(args)
+	if err != nil {
+		log.Printf("Error db query %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	page := followPage{Users: follows}
+	if len(follows) > int(limit) {
+		page.Users = follows[:limit]
+		last := page.Users[len(page.Users)-1]
+		page.NextCursor = chirpCursor{CreatedAt: last.FollowedAt, ID: last.UserID}.encode()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	js, _ := json.Marshal(page)
+	w.Write(js)
+}
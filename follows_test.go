@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/deoreal/chirpy/internal/database"
+	"github.com/deoreal/chirpy/internal/timeline"
+	"github.com/google/uuid"
+)
+
+func TestFollowUserRejectsSelf(t *testing.T) {
+	cfg := &apiConfig{}
+	userID := uuid.New()
+
+	req := httptest.NewRequest("PUT", "/api/users/"+userID.String()+"/follow", nil)
+	req.SetPathValue("userID", userID.String())
+	req = req.WithContext(context.WithValue(req.Context(), userIDKey, userID))
+	rec := httptest.NewRecorder()
+	cfg.followUser(rec, req)
+
+	if rec.Code != 400 {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+}
+
+func TestListFollowsRejectsBadPage(t *testing.T) {
+	cfg := &apiConfig{}
+
+	req := httptest.NewRequest("GET", "/api/users/x/following?limit=0", nil)
+	req.SetPathValue("userID", uuid.NewString())
+	rec := httptest.NewRecorder()
+	cfg.listFollowing(rec, req)
+
+	if rec.Code != 400 {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+}
+
+func TestFollows(t *testing.T) {
+	cfg := newDBConfig(t)
+	ctx := context.Background()
+
+	alice := createTestUser(t, cfg, "alice@example.com")
+	bob := createTestUser(t, cfg, "bob@example.com")
+	carol := createTestUser(t, cfg, "carol@example.com")
+
+	call := func(h http.HandlerFunc, follower, followee uuid.UUID) int {
+		t.Helper()
+		req := requestAs(follower, "PUT", "/api/users/x/follow", "")
+		req.SetPathValue("userID", followee.String())
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec.Code
+	}
+	follow, unfollow := cfg.followUser, cfg.unfollowUser
+	followers := func(userID uuid.UUID) int32 {
+		t.Helper()
+		n, err := cfg.dbQueries.GetFollowerCount(ctx, userID)
+		if err != nil {
+			t.Fatalf("GetFollowerCount() error = %v", err)
+		}
+		return n
+	}
+
+	for _, f := range [][2]uuid.UUID{{alice, bob}, {alice, bob}, {carol, bob}, {alice, carol}} {
+		if code := call(follow, f[0], f[1]); code != 204 {
+			t.Fatalf("followUser status = %d, want 204", code)
+		}
+	}
+	if code := call(follow, alice, uuid.New()); code != 404 {
+		t.Errorf("following an unknown user: status = %d, want 404", code)
+	}
+	if n := followers(bob); n != 2 {
+		t.Errorf("bob has %d followers after a repeated follow, want 2", n)
+	}
+
+	list := func(h http.HandlerFunc, userID uuid.UUID, query url.Values) followPage {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/api/users/x/followers?"+query.Encode(), nil)
+		req.SetPathValue("userID", userID.String())
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		var page followPage
+		if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil || rec.Code != 200 {
+			t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+		}
+		return page
+	}
+	first := list(cfg.listFollowers, bob, url.Values{"limit": {"1"}})
+	if len(first.Users) != 1 || first.Users[0].UserID != carol || first.NextCursor == "" {
+		t.Fatalf("first page of bob's followers = %+v, want carol and a cursor", first)
+	}
+	second := list(cfg.listFollowers, bob, url.Values{"limit": {"1"}, "cursor": {first.NextCursor}})
+	if len(second.Users) != 1 || second.Users[0].UserID != alice || second.NextCursor != "" {
+		t.Errorf("second page of bob's followers = %+v, want alice and no cursor", second)
+	}
+	if page := list(cfg.listFollowing, alice, nil); len(page.Users) != 2 || page.Users[0].UserID != carol || page.Users[1].UserID != bob {
+		t.Errorf("alice follows %+v, want carol then bob", page.Users)
+	}
+
+	post := func(userID uuid.UUID, body string) uuid.UUID {
+		t.Helper()
+		chr, err := cfg.dbQueries.CreateChirp(ctx, database.CreateChirpParams{Body: body, UserID: userID})
+		if err != nil {
+			t.Fatalf("CreateChirp() error = %v", err)
+		}
+		cfg.fanOut(chr)
+		return chr.ID
+	}
+	own := post(alice, "alice's chirp")
+	bobs := post(bob, "bob's chirp")
+	post(carol, "carol's chirp")
+
+	for _, cache := range []*timeline.Cache{nil, timeline.NewCache(10, 100)} {
+		cfg.Timelines = cache
+		got := readTimeline(t, cfg, bob)
+		if len(got) != 1 || got[0] != bobs {
+			t.Errorf("cache %v: bob's timeline = %v, want only his own chirp", cache != nil, got)
+		}
+		if got := readTimeline(t, cfg, alice); len(got) != 3 || got[2] != own {
+			t.Errorf("cache %v: alice's timeline = %v, want 3 chirps ending with her own", cache != nil, got)
+		}
+
+		if code := call(unfollow, alice, carol); code != 204 {
+			t.Fatalf("unfollowUser status = %d, want 204", code)
+		}
+		if code := call(unfollow, alice, carol); code != 204 {
+			t.Errorf("repeated unfollowUser status = %d, want 204", code)
+		}
+		if n := followers(carol); n != 0 {
+			t.Errorf("carol has %d followers after unfollow, want 0", n)
+		}
+		if got := readTimeline(t, cfg, alice); len(got) != 2 || got[0] != bobs || got[1] != own {
+			t.Errorf("cache %v: after unfollowing carol alice's timeline = %v, want [%v %v]", cache != nil, got, bobs, own)
+		}
+		if code := call(follow, alice, carol); code != 204 {
+			t.Fatalf("followUser status = %d, want 204", code)
+		}
+	}
+}
@@ -14,4 +14,6 @@ require (
 	golang.org/x/crypto v0.42.0
 )
 
-require github.com/golang-jwt/jwt/v5 v5.3.0 // indirect
+require github.com/golang-jwt/jwt/v5 v5.3.0
+
+require golang.org/x/sys v0.36.0 // indirect
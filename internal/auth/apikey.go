@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// APIKeyPrefix marks personal API keys so they are easy to recognise in
+// logs and secret scanners.
+const APIKeyPrefix = "chirpy_"
+
+// apiKeyDisplayLen is how much of a key is kept in clear so users can tell
+// their keys apart after the secret itself has been shown once.
+const apiKeyDisplayLen = len(APIKeyPrefix) + 6
+
+// MakeAPIKey returns a new random API key together with its display prefix
+// and the hash to store.
+func MakeAPIKey() (key, prefix, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate api key: %s", err)
+	}
+	key = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	return key, key[:apiKeyDisplayLen], HashAPIKey(key), nil
+}
+
+// HashAPIKey returns the stored form of an API key. Keys carry 256 bits of
+// randomness, so a fast hash is sufficient and allows lookup by hash.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(key)))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMakeAPIKey(t *testing.T) {
+	key, prefix, hash, err := MakeAPIKey()
+	if err != nil {
+		t.Fatalf("MakeAPIKey() error = %v", err)
+	}
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		t.Errorf("key %q does not start with %q", key, APIKeyPrefix)
+	}
+	if !strings.HasPrefix(key, prefix) || prefix == key {
+		t.Errorf("prefix %q is not a strict prefix of the key", prefix)
+	}
+	if hash != HashAPIKey(key) {
+		t.Errorf("hash does not match HashAPIKey(key)")
+	}
+	if strings.Contains(hash, key) {
+		t.Errorf("hash contains the key")
+	}
+
+	other, _, otherHash, err := MakeAPIKey()
+	if err != nil {
+		t.Fatalf("MakeAPIKey() error = %v", err)
+	}
+	if other == key || otherHash == hash {
+		t.Errorf("two calls returned the same key")
+	}
+}
+
+func TestHashAPIKey(t *testing.T) {
+	if HashAPIKey("chirpy_abc") != HashAPIKey(" chirpy_abc ") {
+		t.Errorf("HashAPIKey() is sensitive to surrounding whitespace")
+	}
+	if HashAPIKey("chirpy_abc") == HashAPIKey("chirpy_abd") {
+		t.Errorf("HashAPIKey() collided on different keys")
+	}
+}
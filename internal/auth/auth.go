@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 	"strings"
@@ -8,80 +10,157 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
 func GetBearerToken(headers http.Header) (string, error) {
+	return getAuthorization(headers, "Bearer")
+}
+
+// GetAPIKey extracts the key from an "Authorization: ApiKey <key>" header.
+func GetAPIKey(headers http.Header) (string, error) {
+	return getAuthorization(headers, "ApiKey")
+}
+
+func getAuthorization(headers http.Header, scheme string) (string, error) {
 	response := http.Header.Get(headers, "Authorization")
 	if response == "" {
 		return "", fmt.Errorf("no authorization header")
 	}
-	items := strings.Split(response, " ")
-
-	token := items[1]
+	prefix, token, ok := strings.Cut(response, " ")
+	if !ok || prefix != scheme || token == "" {
+		return "", fmt.Errorf("malformed authorization header")
+	}
 
 	return token, nil
 }
 
+// HashPassword hashes password with DefaultHasher.
 func HashPassword(password string) (string, error) {
-	if len(password) > 36 {
-		return "", fmt.Errorf("password cannot have more than 36 UTF8-characters")
-	}
-	pw, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", fmt.Errorf("failed to hash password: %s", err)
-	}
-
-	return string(pw), nil
+	return DefaultHasher.Hash(password)
 }
 
+// CheckPasswordHash verifies password against hash, picking the algorithm
+// from the hash's prefix.
 func CheckPasswordHash(password, hash string) error {
-	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+	h, err := hasherFor(hash)
+	if err != nil {
 		return fmt.Errorf("password does not match")
 	}
-	return nil
+
+	return h.Verify(password, hash)
+}
+
+// Claims are the claims chirpy signs into its tokens. Role is only set on
+// access tokens and is advisory until the token expires: a role change
+// takes effect on the next refresh. SessionID names the login session an
+// access token belongs to, so revoking the session revokes the token.
+type Claims struct {
+	Role      string `json:"role,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+	jwt.RegisteredClaims
 }
 
+// MakeJWT signs an HS256 access token for userID with tokenSecret.
 func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	claims := &jwt.RegisteredClaims{
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Issuer:    "chirpy",
-		Subject:   string(userID.String()),
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+	key, err := NewHMACKey(tokenSecret)
+	if err != nil {
+		return "", err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	return MakeJWTWithKey(userID, key, expiresIn)
+}
 
-	tokenString, err := token.SignedString(tokenSecret)
+// MakeJWTWithKey signs an access token for userID with key.
+func MakeJWTWithKey(userID uuid.UUID, key *SigningKey, expiresIn time.Duration) (string, error) {
+	return signToken(newClaims(userID), key, "", expiresIn)
+}
+
+func newClaims(userID uuid.UUID) Claims {
+	return Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: userID.String()}}
+}
+
+// signToken signs claims after setting the issuer and lifetime. Access
+// tokens have no audience; purpose-specific tokens (such as 2FA
+// challenges) set one so they can never be mistaken for access tokens.
+func signToken(claims Claims, key *SigningKey, kid string, expiresIn time.Duration) (string, error) {
+	if expiresIn <= 0 {
+		return "", fmt.Errorf("token expiry must be positive")
+	}
+	sk, err := key.signKey()
 	if err != nil {
 		return "", err
 	}
-	fmt.Println(tokenString, err)
 
-	return tokenString, nil
+	now := time.Now().UTC()
+	claims.Issuer = "chirpy"
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(expiresIn))
+
+	token := jwt.NewWithClaims(key.Method, &claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	return token.SignedString(sk)
 }
 
+// ValidateJWT verifies an HS256 access token signed with tokenSecret and
+// returns the user ID in its subject.
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (any, error) {
-		return []byte(tokenSecret), nil
+	key, err := NewHMACKey(tokenSecret)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+
+	return ValidateJWTWithKey(tokenString, key)
+}
+
+// ValidateJWTWithKey verifies an access token against key. Tokens signed
+// with any algorithm other than key.Method are rejected.
+func ValidateJWTWithKey(tokenString string, key *SigningKey) (uuid.UUID, error) {
+	claims, err := parseToken(tokenString, []string{key.Method.Alg()}, "", func(token *jwt.Token) (any, error) {
+		return key.verifyKey(), nil
 	})
 	if err != nil {
 		return uuid.UUID{}, err
 	}
 
+	return uuid.Parse(claims.Subject)
+}
+
+// parseToken verifies tokenString and returns its claims. An empty
+// audience accepts only tokens without one, i.e. access tokens.
+func parseToken(tokenString string, algs []string, audience string, keyFunc jwt.Keyfunc) (*Claims, error) {
+	opts := []jwt.ParserOption{jwt.WithValidMethods(algs), jwt.WithIssuer("chirpy"), jwt.WithExpirationRequired()}
+	if audience != "" {
+		opts = append(opts, jwt.WithAudience(audience))
+	}
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, keyFunc, opts...)
+	if err != nil {
+		return nil, err
+	}
+
 	if !token.Valid {
-		return uuid.UUID{}, jwt.ErrSignatureInvalid
+		return nil, jwt.ErrSignatureInvalid
 	}
 
-	claims, ok := token.Claims.(*jwt.RegisteredClaims)
+	claims, ok := token.Claims.(*Claims)
 	if !ok {
-		return uuid.UUID{}, jwt.ErrInvalidType
+		return nil, jwt.ErrInvalidType
 	}
-	fmt.Println("claims", claims)
-	userID, err := uuid.Parse(claims.Subject)
-	if err != nil {
-		return uuid.UUID{}, err
+	if audience == "" && len(claims.Audience) > 0 {
+		return nil, jwt.ErrTokenInvalidAudience
+	}
+
+	return claims, nil
+}
+
+// MakeRefreshToken returns a random 256-bit token encoded as hex.
+func MakeRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %s", err)
 	}
 
-	return userID, nil
+	return hex.EncodeToString(b), nil
 }
@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Keyring holds the signing keys known to the server, identified by the
+// "kid" header of the tokens they sign. New tokens are signed with the
+// active key; tokens signed by any key that has not been retired still
+// validate, so keys can be rotated without invalidating live sessions.
+type Keyring struct {
+	mu     sync.RWMutex
+	keys   map[string]*SigningKey
+	retire map[string]bool
+	active string
+}
+
+func NewKeyring() *Keyring {
+	return &Keyring{
+		keys:   map[string]*SigningKey{},
+		retire: map[string]bool{},
+	}
+}
+
+// Add registers key under kid. The first key that can sign becomes active.
+func (r *Keyring) Add(kid string, key *SigningKey) error {
+	if kid == "" {
+		return fmt.Errorf("key id cannot be empty")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.keys[kid]; ok {
+		return fmt.Errorf("duplicate key id %q", kid)
+	}
+	r.keys[kid] = key
+	if r.active == "" {
+		if _, err := key.signKey(); err == nil {
+			r.active = kid
+		}
+	}
+
+	return nil
+}
+
+// SetActive selects the key used to sign new tokens.
+func (r *Keyring) SetActive(kid string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key, ok := r.keys[kid]
+	if !ok || r.retire[kid] {
+		return fmt.Errorf("unknown key id %q", kid)
+	}
+	if _, err := key.signKey(); err != nil {
+		return err
+	}
+	r.active = kid
+
+	return nil
+}
+
+// Retire stops accepting tokens signed by kid. The active key cannot be retired.
+func (r *Keyring) Retire(kid string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.keys[kid]; !ok {
+		return fmt.Errorf("unknown key id %q", kid)
+	}
+	if kid == r.active {
+		return fmt.Errorf("cannot retire the active key %q", kid)
+	}
+	r.retire[kid] = true
+
+	return nil
+}
+
+// MakeJWT signs an access token for userID with the active key. role is
+// carried in the token's role claim.
+func (r *Keyring) MakeJWT(userID uuid.UUID, role string, expiresIn time.Duration) (string, error) {
+	return r.MakeSessionJWT(userID, role, uuid.Nil, expiresIn)
+}
+
+// MakeSessionJWT is MakeJWT for a token tied to a login session. A nil
+// sessionID omits the sid claim.
+func (r *Keyring) MakeSessionJWT(userID uuid.UUID, role string, sessionID uuid.UUID, expiresIn time.Duration) (string, error) {
+	claims := newClaims(userID)
+	claims.Role = role
+	if sessionID != uuid.Nil {
+		claims.SessionID = sessionID.String()
+	}
+
+	return r.sign(claims, expiresIn)
+}
+
+// MakeAudienceJWT signs a token for userID that is only accepted by
+// ValidateAudienceJWT with the same audience.
+func (r *Keyring) MakeAudienceJWT(userID uuid.UUID, audience string, expiresIn time.Duration) (string, error) {
+	claims := newClaims(userID)
+	if audience != "" {
+		claims.Audience = jwt.ClaimStrings{audience}
+	}
+
+	return r.sign(claims, expiresIn)
+}
+
+// MakeOneTimeJWT is MakeAudienceJWT with a fresh token ID. Callers record
+// the ID and mark it used when the token is redeemed, since the signature
+// alone cannot stop a token from being replayed.
+func (r *Keyring) MakeOneTimeJWT(userID uuid.UUID, audience string, expiresIn time.Duration) (string, uuid.UUID, error) {
+	id := uuid.New()
+	claims := newClaims(userID)
+	if audience != "" {
+		claims.Audience = jwt.ClaimStrings{audience}
+	}
+	claims.ID = id.String()
+	token, err := r.sign(claims, expiresIn)
+	if err != nil {
+		return "", uuid.UUID{}, err
+	}
+
+	return token, id, nil
+}
+
+func (r *Keyring) sign(claims Claims, expiresIn time.Duration) (string, error) {
+	r.mu.RLock()
+	kid := r.active
+	key := r.keys[kid]
+	r.mu.RUnlock()
+	if key == nil {
+		return "", fmt.Errorf("keyring has no active signing key")
+	}
+
+	return signToken(claims, key, kid, expiresIn)
+}
+
+// ValidateJWT verifies an access token against the non-retired key named
+// by its kid header and returns the user ID in its subject.
+func (r *Keyring) ValidateJWT(tokenString string) (uuid.UUID, error) {
+	return r.ValidateAudienceJWT(tokenString, "")
+}
+
+// ValidateJWTClaims is ValidateJWT returning all of the token's claims.
+func (r *Keyring) ValidateJWTClaims(tokenString string) (*Claims, error) {
+	return r.parse(tokenString, "")
+}
+
+// ValidateAudienceJWT is ValidateJWT for tokens made by MakeAudienceJWT.
+func (r *Keyring) ValidateAudienceJWT(tokenString, audience string) (uuid.UUID, error) {
+	claims, err := r.parse(tokenString, audience)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+
+	return uuid.Parse(claims.Subject)
+}
+
+// ValidateOneTimeJWT verifies a token made by MakeOneTimeJWT and returns
+// its user ID and token ID.
+func (r *Keyring) ValidateOneTimeJWT(tokenString, audience string) (uuid.UUID, uuid.UUID, error) {
+	claims, err := r.parse(tokenString, audience)
+	if err != nil {
+		return uuid.UUID{}, uuid.UUID{}, err
+	}
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.UUID{}, uuid.UUID{}, err
+	}
+	id, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return uuid.UUID{}, uuid.UUID{}, fmt.Errorf("token has no valid id: %s", err)
+	}
+
+	return userID, id, nil
+}
+
+func (r *Keyring) parse(tokenString, audience string) (*Claims, error) {
+	r.mu.RLock()
+	var algs []string
+	for kid, key := range r.keys {
+		if !r.retire[kid] {
+			algs = append(algs, key.Method.Alg())
+		}
+	}
+	r.mu.RUnlock()
+
+	return parseToken(tokenString, algs, audience, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		r.mu.RLock()
+		key, ok := r.keys[kid]
+		retired := r.retire[kid]
+		r.mu.RUnlock()
+		if !ok || retired {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), kid)
+		}
+
+		return key.verifyKey(), nil
+	})
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y,omitempty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public halves of all non-retired asymmetric keys.
+// HMAC keys are never published.
+func (r *Keyring) JWKS() JWKSet {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+	for kid, key := range r.keys {
+		if r.retire[kid] {
+			continue
+		}
+		jwk, ok := publicJWK(kid, key)
+		if ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+
+	return set
+}
+
+func publicJWK(kid string, key *SigningKey) (JWK, bool) {
+	enc := base64.RawURLEncoding
+	switch pub := key.public.(type) {
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		return JWK{
+			Kty: "EC",
+			Crv: pub.Curve.Params().Name,
+			X:   enc.EncodeToString(pub.X.FillBytes(make([]byte, size))),
+			Y:   enc.EncodeToString(pub.Y.FillBytes(make([]byte, size))),
+			Kid: kid,
+			Alg: key.Method.Alg(),
+			Use: "sig",
+		}, true
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   enc.EncodeToString(pub),
+			Kid: kid,
+			Alg: key.Method.Alg(),
+			Use: "sig",
+		}, true
+	default:
+		return JWK{}, false
+	}
+}
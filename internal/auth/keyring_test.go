@@ -0,0 +1,304 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func newTestECKey(t *testing.T) *SigningKey {
+	t.Helper()
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ECDSA key: %v", err)
+	}
+	der, err := x509.MarshalECPrivateKey(k)
+	if err != nil {
+		t.Fatalf("failed to marshal ECDSA key: %v", err)
+	}
+	key, err := ParseSigningKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("ParseSigningKeyPEM() error = %v", err)
+	}
+	return key
+}
+
+func newTestEdKey(t *testing.T) *SigningKey {
+	t.Helper()
+	_, k, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate Ed25519 key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(k)
+	if err != nil {
+		t.Fatalf("failed to marshal Ed25519 key: %v", err)
+	}
+	key, err := ParseSigningKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("ParseSigningKeyPEM() error = %v", err)
+	}
+	return key
+}
+
+func TestKeyringRotation(t *testing.T) {
+	ring := NewKeyring()
+	if err := ring.Add("old", newTestECKey(t)); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := ring.Add("new", newTestEdKey(t)); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	userID := uuid.New()
+	oldToken, err := ring.MakeJWT(userID, "user", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+
+	if err := ring.SetActive("new"); err != nil {
+		t.Fatalf("SetActive() error = %v", err)
+	}
+	newToken, err := ring.MakeJWT(userID, "user", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		got, err := ring.ValidateJWT(token)
+		if err != nil {
+			t.Fatalf("ValidateJWT(%s) error = %v", name, err)
+		}
+		if got != userID {
+			t.Errorf("ValidateJWT(%s) = %v, want %v", name, got, userID)
+		}
+	}
+
+	if err := ring.Retire("new"); err == nil {
+		t.Error("Retire() of the active key expected error but got none")
+	}
+	if err := ring.Retire("old"); err != nil {
+		t.Fatalf("Retire() error = %v", err)
+	}
+	if _, err := ring.ValidateJWT(oldToken); err == nil {
+		t.Error("ValidateJWT() accepted a token signed by a retired key")
+	}
+	if _, err := ring.ValidateJWT(newToken); err != nil {
+		t.Errorf("ValidateJWT() error = %v after retiring another key", err)
+	}
+}
+
+func TestKeyringRejectsUnknownKid(t *testing.T) {
+	ring := NewKeyring()
+	hmac, err := NewHMACKey("test_secret_key")
+	if err != nil {
+		t.Fatalf("NewHMACKey() error = %v", err)
+	}
+	if err := ring.Add("default", hmac); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	// Same secret, but no kid header.
+	token, err := MakeJWT(uuid.New(), "test_secret_key", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+	if _, err := ring.ValidateJWT(token); err == nil {
+		t.Error("ValidateJWT() accepted a token without a kid")
+	}
+
+	if err := ring.Add("default", hmac); err == nil {
+		t.Error("Add() with a duplicate kid expected error but got none")
+	}
+	if err := ring.SetActive("missing"); err == nil {
+		t.Error("SetActive() with an unknown kid expected error but got none")
+	}
+}
+
+func TestKeyringJWKS(t *testing.T) {
+	ring := NewKeyring()
+	hmac, err := NewHMACKey("test_secret_key")
+	if err != nil {
+		t.Fatalf("NewHMACKey() error = %v", err)
+	}
+	if err := ring.Add("hmac", hmac); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := ring.Add("ec", newTestECKey(t)); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := ring.Add("ed", newTestEdKey(t)); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	set := ring.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("JWKS() returned %d keys, want 2", len(set.Keys))
+	}
+
+	ec, ed := set.Keys[0], set.Keys[1]
+	if ec.Kid != "ec" || ec.Kty != "EC" || ec.Crv != "P-256" || ec.Alg != "ES256" || len(ec.X) != 43 || len(ec.Y) != 43 {
+		t.Errorf("unexpected EC JWK %+v", ec)
+	}
+	if ed.Kid != "ed" || ed.Kty != "OKP" || ed.Crv != "Ed25519" || ed.Alg != "EdDSA" || ed.Y != "" {
+		t.Errorf("unexpected Ed25519 JWK %+v", ed)
+	}
+
+	if err := ring.Retire("ec"); err != nil {
+		t.Fatalf("Retire() error = %v", err)
+	}
+	if n := len(ring.JWKS().Keys); n != 1 {
+		t.Errorf("JWKS() returned %d keys after retiring one, want 1", n)
+	}
+}
+
+func TestKeyringAudienceTokens(t *testing.T) {
+	ring := NewKeyring()
+	hmac, err := NewHMACKey("test_secret_key")
+	if err != nil {
+		t.Fatalf("NewHMACKey() error = %v", err)
+	}
+	if err := ring.Add("default", hmac); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	userID := uuid.New()
+	challenge, err := ring.MakeAudienceJWT(userID, "chirpy-2fa", time.Minute)
+	if err != nil {
+		t.Fatalf("MakeAudienceJWT() error = %v", err)
+	}
+	access, err := ring.MakeJWT(userID, "user", time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+
+	if got, err := ring.ValidateAudienceJWT(challenge, "chirpy-2fa"); err != nil || got != userID {
+		t.Errorf("ValidateAudienceJWT() = %v, %v; want %v", got, err, userID)
+	}
+	if _, err := ring.ValidateJWT(challenge); err == nil {
+		t.Error("ValidateJWT() accepted a token with an audience")
+	}
+	if _, err := ring.ValidateAudienceJWT(challenge, "other"); err == nil {
+		t.Error("ValidateAudienceJWT() accepted a token for another audience")
+	}
+	if _, err := ring.ValidateAudienceJWT(access, "chirpy-2fa"); err == nil {
+		t.Error("ValidateAudienceJWT() accepted an access token")
+	}
+}
+
+func TestKeyringOneTimeTokens(t *testing.T) {
+	ring := NewKeyring()
+	hmac, err := NewHMACKey("test_secret_key")
+	if err != nil {
+		t.Fatalf("NewHMACKey() error = %v", err)
+	}
+	if err := ring.Add("default", hmac); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	userID := uuid.New()
+	token, id, err := ring.MakeOneTimeJWT(userID, "chirpy-password-reset", time.Minute)
+	if err != nil {
+		t.Fatalf("MakeOneTimeJWT() error = %v", err)
+	}
+	_, other, err := ring.MakeOneTimeJWT(userID, "chirpy-password-reset", time.Minute)
+	if err != nil {
+		t.Fatalf("MakeOneTimeJWT() error = %v", err)
+	}
+	if id == other {
+		t.Error("MakeOneTimeJWT() reused a token id")
+	}
+
+	gotUser, gotID, err := ring.ValidateOneTimeJWT(token, "chirpy-password-reset")
+	if err != nil {
+		t.Fatalf("ValidateOneTimeJWT() error = %v", err)
+	}
+	if gotUser != userID || gotID != id {
+		t.Errorf("ValidateOneTimeJWT() = %v, %v; want %v, %v", gotUser, gotID, userID, id)
+	}
+
+	if _, _, err := ring.ValidateOneTimeJWT(token, "chirpy-verify-email"); err == nil {
+		t.Error("ValidateOneTimeJWT() accepted a token for another audience")
+	}
+	challenge, err := ring.MakeAudienceJWT(userID, "chirpy-password-reset", time.Minute)
+	if err != nil {
+		t.Fatalf("MakeAudienceJWT() error = %v", err)
+	}
+	if _, _, err := ring.ValidateOneTimeJWT(challenge, "chirpy-password-reset"); err == nil {
+		t.Error("ValidateOneTimeJWT() accepted a token without an id")
+	}
+}
+
+func TestKeyringRoleClaim(t *testing.T) {
+	ring := NewKeyring()
+	hmac, err := NewHMACKey("test_secret_key")
+	if err != nil {
+		t.Fatalf("NewHMACKey() error = %v", err)
+	}
+	if err := ring.Add("default", hmac); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	userID := uuid.New()
+	token, err := ring.MakeJWT(userID, "admin", time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+	claims, err := ring.ValidateJWTClaims(token)
+	if err != nil {
+		t.Fatalf("ValidateJWTClaims() error = %v", err)
+	}
+	if claims.Role != "admin" || claims.Subject != userID.String() {
+		t.Errorf("claims = role %q subject %q; want admin %v", claims.Role, claims.Subject, userID)
+	}
+
+	challenge, err := ring.MakeAudienceJWT(userID, "chirpy-2fa", time.Minute)
+	if err != nil {
+		t.Fatalf("MakeAudienceJWT() error = %v", err)
+	}
+	if _, err := ring.ValidateJWTClaims(challenge); err == nil {
+		t.Error("ValidateJWTClaims() accepted a token with an audience")
+	}
+}
+
+func TestKeyringSessionClaim(t *testing.T) {
+	ring := NewKeyring()
+	hmac, err := NewHMACKey("test_secret_key")
+	if err != nil {
+		t.Fatalf("NewHMACKey() error = %v", err)
+	}
+	if err := ring.Add("default", hmac); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	sessionID := uuid.New()
+	token, err := ring.MakeSessionJWT(uuid.New(), "user", sessionID, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeSessionJWT() error = %v", err)
+	}
+	claims, err := ring.ValidateJWTClaims(token)
+	if err != nil {
+		t.Fatalf("ValidateJWTClaims() error = %v", err)
+	}
+	if claims.SessionID != sessionID.String() {
+		t.Errorf("sid = %q, want %v", claims.SessionID, sessionID)
+	}
+
+	token, err = ring.MakeJWT(uuid.New(), "user", time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+	claims, err = ring.ValidateJWTClaims(token)
+	if err != nil {
+		t.Fatalf("ValidateJWTClaims() error = %v", err)
+	}
+	if claims.SessionID != "" {
+		t.Errorf("sid = %q, want none", claims.SessionID)
+	}
+}
@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey pairs a JWT signing method with the key material it needs.
+// HMAC keys sign and verify with the same secret; asymmetric keys sign
+// with the private key and verify with the public key, so a SigningKey
+// loaded from a public key alone can only verify.
+type SigningKey struct {
+	Method  jwt.SigningMethod
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+	secret  []byte
+}
+
+// NewHMACKey returns an HS256 key for the given shared secret.
+func NewHMACKey(secret string) (*SigningKey, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("token secret cannot be empty")
+	}
+
+	return &SigningKey{Method: jwt.SigningMethodHS256, secret: []byte(secret)}, nil
+}
+
+// LoadSigningKey reads a PEM encoded ECDSA (P-256, P-384, P-521) or Ed25519
+// private key from path.
+func LoadSigningKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %s", err)
+	}
+
+	return ParseSigningKeyPEM(data)
+}
+
+// LoadVerificationKey reads a PEM encoded ECDSA or Ed25519 public key from
+// path. The returned key can validate tokens but not create them.
+func LoadVerificationKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read verification key: %s", err)
+	}
+
+	return ParseVerificationKeyPEM(data)
+}
+
+// LoadKey reads a PEM encoded key from path. A private key can sign and
+// verify; a public key ("PUBLIC KEY") loads as a verify-only key, e.g. to
+// keep accepting tokens from a key whose private half has been withdrawn.
+func LoadKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %s", err)
+	}
+
+	if block, _ := pem.Decode(data); block != nil && block.Type == "PUBLIC KEY" {
+		return ParseVerificationKeyPEM(data)
+	}
+	return ParseSigningKeyPEM(data)
+}
+
+// ParseSigningKeyPEM parses a PEM encoded ECDSA or Ed25519 private key, in
+// SEC 1 ("EC PRIVATE KEY") or PKCS #8 ("PRIVATE KEY") form.
+func ParseSigningKeyPEM(data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	var key any
+	var err error
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %s", err)
+	}
+
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		method, err := ecdsaMethod(k.Curve)
+		if err != nil {
+			return nil, err
+		}
+		return &SigningKey{Method: method, private: k, public: &k.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{Method: jwt.SigningMethodEdDSA, private: k, public: k.Public()}, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+}
+
+// ParseVerificationKeyPEM parses a PEM encoded PKIX ("PUBLIC KEY") ECDSA or
+// Ed25519 public key. The returned key can validate tokens but not create
+// them.
+func ParseVerificationKeyPEM(data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	if block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %s", err)
+	}
+
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		method, err := ecdsaMethod(k.Curve)
+		if err != nil {
+			return nil, err
+		}
+		return &SigningKey{Method: method, public: k}, nil
+	case ed25519.PublicKey:
+		return &SigningKey{Method: jwt.SigningMethodEdDSA, public: k}, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", key)
+	}
+}
+
+func ecdsaMethod(curve elliptic.Curve) (jwt.SigningMethod, error) {
+	switch curve {
+	case elliptic.P256():
+		return jwt.SigningMethodES256, nil
+	case elliptic.P384():
+		return jwt.SigningMethodES384, nil
+	case elliptic.P521():
+		return jwt.SigningMethodES512, nil
+	default:
+		return nil, fmt.Errorf("unsupported ECDSA curve %s", curve.Params().Name)
+	}
+}
+
+func (k *SigningKey) signKey() (any, error) {
+	if k.secret != nil {
+		return k.secret, nil
+	}
+	if k.private == nil {
+		return nil, fmt.Errorf("key cannot sign tokens: no private key")
+	}
+
+	return k.private, nil
+}
+
+func (k *SigningKey) verifyKey() any {
+	if k.secret != nil {
+		return k.secret
+	}
+
+	return k.public
+}
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestLoadSigningKeyRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ECDSA key: %v", err)
+	}
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatalf("failed to marshal ECDSA key: %v", err)
+	}
+	ecPubDER, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to marshal ECDSA public key: %v", err)
+	}
+
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate Ed25519 key: %v", err)
+	}
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatalf("failed to marshal Ed25519 key: %v", err)
+	}
+	edPubDER, err := x509.MarshalPKIXPublicKey(edPub)
+	if err != nil {
+		t.Fatalf("failed to marshal Ed25519 public key: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		private string
+		public  string
+		alg     string
+	}{
+		{
+			name:    "ecdsa p-256",
+			private: writePEM(t, dir, "ec.pem", "EC PRIVATE KEY", ecDER),
+			public:  writePEM(t, dir, "ec.pub.pem", "PUBLIC KEY", ecPubDER),
+			alg:     "ES256",
+		},
+		{
+			name:    "ed25519",
+			private: writePEM(t, dir, "ed.pem", "PRIVATE KEY", edDER),
+			public:  writePEM(t, dir, "ed.pub.pem", "PUBLIC KEY", edPubDER),
+			alg:     "EdDSA",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, err := LoadSigningKey(tt.private)
+			if err != nil {
+				t.Fatalf("LoadSigningKey() error = %v", err)
+			}
+			if signer.Method.Alg() != tt.alg {
+				t.Errorf("Method = %s, want %s", signer.Method.Alg(), tt.alg)
+			}
+			verifier, err := LoadVerificationKey(tt.public)
+			if err != nil {
+				t.Fatalf("LoadVerificationKey() error = %v", err)
+			}
+
+			userID := uuid.New()
+			token, err := MakeJWTWithKey(userID, signer, time.Hour)
+			if err != nil {
+				t.Fatalf("MakeJWTWithKey() error = %v", err)
+			}
+
+			got, err := ValidateJWTWithKey(token, verifier)
+			if err != nil {
+				t.Fatalf("ValidateJWTWithKey() error = %v", err)
+			}
+			if got != userID {
+				t.Errorf("ValidateJWTWithKey() = %v, want %v", got, userID)
+			}
+
+			if _, err := MakeJWTWithKey(userID, verifier, time.Hour); err == nil {
+				t.Error("MakeJWTWithKey() with a public key expected error but got none")
+			}
+			if _, err := ValidateJWT(token, "test_secret_key"); err == nil {
+				t.Error("ValidateJWT() accepted an asymmetric token with an HMAC secret")
+			}
+		})
+	}
+}
+
+func TestParseSigningKeyPEMErrors(t *testing.T) {
+	rsaLike := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: []byte("junk")})
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "not pem", data: []byte("not a key")},
+		{name: "unsupported block", data: rsaLike},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseSigningKeyPEM(tt.data); err == nil {
+				t.Error("ParseSigningKeyPEM() expected error but got none")
+			}
+		})
+	}
+}
+
+func TestNewHMACKeyEmptySecret(t *testing.T) {
+	if _, err := NewHMACKey(""); err == nil {
+		t.Error("NewHMACKey() expected error for empty secret")
+	}
+}
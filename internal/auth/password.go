@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher hashes passwords into a self-describing string and
+// verifies passwords against hashes it produced.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, hash string) error
+	// Recognizes reports whether hash was produced by this algorithm.
+	Recognizes(hash string) bool
+	// NeedsRehash reports whether hash uses weaker parameters than the hasher.
+	NeedsRehash(hash string) bool
+}
+
+// DefaultHasher is used by HashPassword for new hashes. CheckPasswordHash
+// still accepts hashes from any algorithm in knownHashers.
+var DefaultHasher PasswordHasher = Argon2idHasher{
+	Memory:  19 * 1024,
+	Time:    2,
+	Threads: 1,
+	SaltLen: 16,
+	KeyLen:  32,
+}
+
+var knownHashers = []PasswordHasher{
+	DefaultHasher,
+	BcryptHasher{Cost: bcrypt.DefaultCost},
+}
+
+// NeedsRehash reports whether hash should be replaced with a fresh
+// DefaultHasher hash, either because it uses another algorithm or
+// because its parameters are out of date.
+func NeedsRehash(hash string) bool {
+	if !DefaultHasher.Recognizes(hash) {
+		return true
+	}
+
+	return DefaultHasher.NeedsRehash(hash)
+}
+
+func hasherFor(hash string) (PasswordHasher, error) {
+	for _, h := range knownHashers {
+		if h.Recognizes(hash) {
+			return h, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown password hash format")
+}
+
+// Argon2idHasher produces PHC formatted argon2id hashes:
+// $argon2id$v=19$m=<memory KiB>,t=<time>,p=<threads>$<salt>$<key>
+type Argon2idHasher struct {
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+type argon2idHash struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to hash password: %s", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h Argon2idHasher) Verify(password, hash string) error {
+	p, err := parseArgon2id(hash)
+	if err != nil {
+		return fmt.Errorf("password does not match")
+	}
+	key := argon2.IDKey([]byte(password), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+	if subtle.ConstantTimeCompare(key, p.key) != 1 {
+		return fmt.Errorf("password does not match")
+	}
+
+	return nil
+}
+
+func (h Argon2idHasher) Recognizes(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (h Argon2idHasher) NeedsRehash(hash string) bool {
+	p, err := parseArgon2id(hash)
+	if err != nil {
+		return true
+	}
+
+	return p.memory < h.Memory || p.time < h.Time || p.threads < h.Threads ||
+		uint32(len(p.salt)) < h.SaltLen || uint32(len(p.key)) < h.KeyLen
+}
+
+func parseArgon2id(hash string) (argon2idHash, error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return argon2idHash{}, fmt.Errorf("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return argon2idHash{}, fmt.Errorf("unsupported argon2 version")
+	}
+
+	var p argon2idHash
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return argon2idHash{}, fmt.Errorf("malformed argon2id parameters")
+	}
+	if p.memory == 0 || p.time == 0 || p.threads == 0 {
+		return argon2idHash{}, fmt.Errorf("malformed argon2id parameters")
+	}
+
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return argon2idHash{}, fmt.Errorf("malformed argon2id salt")
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(p.key) == 0 {
+		return argon2idHash{}, fmt.Errorf("malformed argon2id key")
+	}
+
+	return p, nil
+}
+
+// BcryptHasher produces bcrypt hashes. bcrypt only looks at the first 72
+// bytes of a password, so longer passwords are rejected.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	if len(password) > 72 {
+		return "", fmt.Errorf("password cannot be longer than 72 bytes")
+	}
+	pw, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %s", err)
+	}
+
+	return string(pw), nil
+}
+
+func (h BcryptHasher) Verify(password, hash string) error {
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return fmt.Errorf("password does not match")
+	}
+
+	return nil
+}
+
+func (h BcryptHasher) Recognizes(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (h BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < h.Cost
+}
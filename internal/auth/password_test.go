@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashPasswordUsesArgon2id(t *testing.T) {
+	hash, err := HashPassword("password123")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$") {
+		t.Errorf("HashPassword() = %q, want a PHC argon2id hash", hash)
+	}
+	if NeedsRehash(hash) {
+		t.Error("NeedsRehash() = true for a fresh default hash")
+	}
+}
+
+func TestCheckPasswordHashBcrypt(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt.GenerateFromPassword() error = %v", err)
+	}
+
+	if err := CheckPasswordHash("password123", string(legacy)); err != nil {
+		t.Errorf("CheckPasswordHash() error = %v for a bcrypt hash", err)
+	}
+	if err := CheckPasswordHash("wrongpassword", string(legacy)); err == nil {
+		t.Error("CheckPasswordHash() expected error for wrong password")
+	}
+	if !NeedsRehash(string(legacy)) {
+		t.Error("NeedsRehash() = false for a bcrypt hash")
+	}
+}
+
+func TestArgon2idNeedsRehash(t *testing.T) {
+	weak := Argon2idHasher{Memory: 8 * 1024, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}
+	hash, err := weak.Hash("password123")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+
+	if err := CheckPasswordHash("password123", hash); err != nil {
+		t.Errorf("CheckPasswordHash() error = %v for a weaker argon2id hash", err)
+	}
+	if !NeedsRehash(hash) {
+		t.Error("NeedsRehash() = false for weaker argon2id parameters")
+	}
+}
+
+func TestArgon2idVerifyMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{name: "too few fields", hash: "$argon2id$v=19$m=19456,t=2,p=1$c2FsdA"},
+		{name: "wrong version", hash: "$argon2id$v=16$m=19456,t=2,p=1$c2FsdHNhbHQ$a2V5a2V5"},
+		{name: "zero memory", hash: "$argon2id$v=19$m=0,t=2,p=1$c2FsdHNhbHQ$a2V5a2V5"},
+		{name: "bad salt", hash: "$argon2id$v=19$m=19456,t=2,p=1$!!!$a2V5a2V5"},
+		{name: "empty key", hash: "$argon2id$v=19$m=19456,t=2,p=1$c2FsdHNhbHQ$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckPasswordHash("password123", tt.hash); err == nil {
+				t.Error("CheckPasswordHash() expected error but got none")
+			}
+		})
+	}
+}
+
+func TestBcryptHasherRejectsLongPasswords(t *testing.T) {
+	h := BcryptHasher{Cost: bcrypt.MinCost}
+	if _, err := h.Hash(strings.Repeat("a", 73)); err == nil {
+		t.Error("Hash() expected error for a 73 byte password")
+	}
+	if _, err := h.Hash(strings.Repeat("a", 72)); err != nil {
+		t.Errorf("Hash() error = %v for a 72 byte password", err)
+	}
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Names of the rules reported by PasswordPolicy.Check.
+const (
+	RuleMinLength = "min_length"
+	RuleMaxLength = "max_length"
+	RuleUpper     = "uppercase"
+	RuleLower     = "lowercase"
+	RuleDigit     = "digit"
+	RuleSymbol    = "symbol"
+	RuleBreached  = "breached"
+)
+
+// PasswordPolicy describes the passwords users may choose. MinLength
+// counts characters; MaxBytes counts bytes so multi-byte passphrases
+// cannot be used to make hashing arbitrarily expensive.
+type PasswordPolicy struct {
+	MinLength     int
+	MaxBytes      int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	Breached      map[string]struct{}
+}
+
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength: 8,
+	MaxBytes:  256,
+}
+
+// PolicyError lists every rule a password failed.
+type PolicyError struct {
+	Failed []string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("password does not meet policy: %s", strings.Join(e.Failed, ", "))
+}
+
+// Check returns a *PolicyError naming the failed rules, or nil.
+func (p PasswordPolicy) Check(password string) error {
+	var failed []string
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		failed = append(failed, RuleMinLength)
+	}
+	if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		failed = append(failed, RuleMaxLength)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		failed = append(failed, RuleUpper)
+	}
+	if p.RequireLower && !lower {
+		failed = append(failed, RuleLower)
+	}
+	if p.RequireDigit && !digit {
+		failed = append(failed, RuleDigit)
+	}
+	if p.RequireSymbol && !symbol {
+		failed = append(failed, RuleSymbol)
+	}
+
+	if _, ok := p.Breached[password]; ok {
+		failed = append(failed, RuleBreached)
+	}
+
+	if len(failed) > 0 {
+		return &PolicyError{Failed: failed}
+	}
+
+	return nil
+}
+
+// LoadBreachedPasswords reads a newline separated list of known breached
+// passwords. Blank lines are ignored.
+func LoadBreachedPasswords(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password list: %s", err)
+	}
+	defer f.Close()
+
+	breached := map[string]struct{}{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		breached[line] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read breached password list: %s", err)
+	}
+
+	return breached, nil
+}
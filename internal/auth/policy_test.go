@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	strict := PasswordPolicy{
+		MinLength:     10,
+		MaxBytes:      20,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+		Breached:      map[string]struct{}{"Password123!": {}},
+	}
+
+	tests := []struct {
+		name     string
+		policy   PasswordPolicy
+		password string
+		want     []string
+	}{
+		{name: "default accepts passphrase", policy: DefaultPasswordPolicy, password: "correct horse battery staple"},
+		{name: "default rejects empty", policy: DefaultPasswordPolicy, password: "", want: []string{RuleMinLength}},
+		{name: "strict accepts", policy: strict, password: "Tr0ub4dor&3x"},
+		{name: "missing classes", policy: strict, password: "abcdefghijk", want: []string{RuleUpper, RuleDigit, RuleSymbol}},
+		{name: "breached", policy: strict, password: "Password123!", want: []string{RuleBreached}},
+		{
+			// 11 characters but 24 bytes.
+			name:     "max length counts bytes",
+			policy:   strict,
+			password: "Ää1!ßøé€€€€",
+			want:     []string{RuleMaxLength},
+		},
+		{name: "too short", policy: strict, password: "Aa1!", want: []string{RuleMinLength}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(tt.password)
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("Check() error = %v, want nil", err)
+				}
+				return
+			}
+
+			var pe *PolicyError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Check() error = %v, want *PolicyError", err)
+			}
+			if !reflect.DeepEqual(pe.Failed, tt.want) {
+				t.Errorf("Check() failed rules = %v, want %v", pe.Failed, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadBreachedPasswords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte("123456\r\npassword\n\nqwerty\n"), 0o600); err != nil {
+		t.Fatalf("failed to write list: %v", err)
+	}
+
+	breached, err := LoadBreachedPasswords(path)
+	if err != nil {
+		t.Fatalf("LoadBreachedPasswords() error = %v", err)
+	}
+	if len(breached) != 3 {
+		t.Errorf("LoadBreachedPasswords() loaded %d entries, want 3", len(breached))
+	}
+	for _, pw := range []string{"123456", "password", "qwerty"} {
+		if _, ok := breached[pw]; !ok {
+			t.Errorf("LoadBreachedPasswords() missing %q", pw)
+		}
+	}
+
+	if _, err := LoadBreachedPasswords(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("LoadBreachedPasswords() expected error for a missing file")
+	}
+}
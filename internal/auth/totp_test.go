@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B, SHA1 variant, truncated to 6 digits.
+func TestTOTPCodeRFC6238(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := TOTPCode(secret, TOTPStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("TOTPCode() error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret() error = %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	step := TOTPStep(now)
+
+	tests := []struct {
+		name     string
+		codeStep int64
+		wantOK   bool
+	}{
+		{name: "current step", codeStep: step, wantOK: true},
+		{name: "previous step", codeStep: step - 1, wantOK: true},
+		{name: "next step", codeStep: step + 1, wantOK: true},
+		{name: "too old", codeStep: step - 2, wantOK: false},
+		{name: "too new", codeStep: step + 2, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := TOTPCode(secret, tt.codeStep)
+			if err != nil {
+				t.Fatalf("TOTPCode() error = %v", err)
+			}
+			got, ok := ValidateTOTP(secret, code, now)
+			if ok != tt.wantOK {
+				t.Fatalf("ValidateTOTP() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && got != tt.codeStep {
+				t.Errorf("ValidateTOTP() step = %d, want %d", got, tt.codeStep)
+			}
+		})
+	}
+
+	if _, ok := ValidateTOTP(secret, "12345", now); ok {
+		t.Error("ValidateTOTP() accepted a short code")
+	}
+	if _, ok := ValidateTOTP("not base32!", "123456", now); ok {
+		t.Error("ValidateTOTP() accepted an invalid secret")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("JBSWY3DPEHPK3PXP", "Chirpy", "alice@example.com")
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("url.Parse() error = %v", err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" {
+		t.Errorf("TOTPURI() = %s, want otpauth://totp/...", uri)
+	}
+	if u.Path != "/Chirpy:alice@example.com" {
+		t.Errorf("label = %q", u.Path)
+	}
+	q := u.Query()
+	if q.Get("secret") != "JBSWY3DPEHPK3PXP" || q.Get("issuer") != "Chirpy" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Errorf("unexpected query %v", q)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes() error = %v", err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("GenerateRecoveryCodes() returned %d codes, want 10", len(codes))
+	}
+
+	seen := map[string]bool{}
+	for _, c := range codes {
+		if len(c) != 11 || c[5] != '-' {
+			t.Errorf("malformed recovery code %q", c)
+		}
+		if seen[c] {
+			t.Errorf("duplicate recovery code %q", c)
+		}
+		seen[c] = true
+	}
+
+	c := codes[0]
+	if HashRecoveryCode(c) != HashRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(c, "-", ""))+" ") {
+		t.Error("HashRecoveryCode() is sensitive to case, dashes or whitespace")
+	}
+	if HashRecoveryCode(codes[0]) == HashRecoveryCode(codes[1]) {
+		t.Error("HashRecoveryCode() collided for different codes")
+	}
+}
@@ -7,29 +7,109 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const countReplies = `-- name: CountReplies :many
+SELECT reply_to_id, COUNT(*) AS replies FROM chirpmsgs
+WHERE reply_to_id = ANY($1::uuid[])
+GROUP BY reply_to_id
+`
+
+type CountRepliesRow struct {
+	ReplyToID uuid.NullUUID
+	Replies   int64
+}
+
+func (q *Queries) CountReplies(ctx context.Context, ids []uuid.UUID) ([]CountRepliesRow, error) {
+	rows, err := q.db.QueryContext(ctx, countReplies, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountRepliesRow
+	for rows.Next() {
+		var i CountRepliesRow
+		if err := rows.Scan(&i.ReplyToID, &i.Replies); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirpmsgs (id, created_at, updated_at, body, user_id)
+INSERT INTO chirpmsgs (id, created_at, updated_at, body, user_id, reply_to_id, quote_of_id)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3,
+    $4
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, reply_to_id, rechirp_of_id, quote_of_id
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body      string
+	UserID    uuid.UUID
+	ReplyToID uuid.NullUUID
+	QuoteOfID uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirpmsg, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.ReplyToID,
+		arg.QuoteOfID,
+	)
+	var i Chirpmsg
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.ReplyToID,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
+	)
+	return i, err
+}
+
+const createRechirp = `-- name: CreateRechirp :one
+INSERT INTO chirpmsgs (id, created_at, updated_at, body, user_id, rechirp_of_id)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    '',
+    $1,
+    $2
+)
+RETURNING id, created_at, updated_at, body, user_id, reply_to_id, rechirp_of_id, quote_of_id
+`
+
+type CreateRechirpParams struct {
+	UserID      uuid.UUID
+	RechirpOfID uuid.NullUUID
+}
+
+func (q *Queries) CreateRechirp(ctx context.Context, arg CreateRechirpParams) (Chirpmsg, error) {
+	row := q.db.QueryRowContext(ctx, createRechirp, arg.UserID, arg.RechirpOfID)
 	var i Chirpmsg
 	err := row.Scan(
 		&i.ID,
@@ -37,12 +117,43 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.ReplyToID,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
 	)
 	return i, err
 }
 
+const deleteChirp = `-- name: DeleteChirp :exec
+DELETE FROM chirpmsgs
+WHERE id = $1
+`
+
+func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteChirp, id)
+	return err
+}
+
+const deleteRechirp = `-- name: DeleteRechirp :execrows
+DELETE FROM chirpmsgs
+WHERE user_id = $1 AND rechirp_of_id = $2
+`
+
+type DeleteRechirpParams struct {
+	UserID      uuid.UUID
+	RechirpOfID uuid.NullUUID
+}
+
+func (q *Queries) DeleteRechirp(ctx context.Context, arg DeleteRechirpParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteRechirp, arg.UserID, arg.RechirpOfID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getChirpById = `-- name: GetChirpById :one
-SELECT id, created_at, updated_at, body, user_id FROM chirpmsgs
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, rechirp_of_id, quote_of_id FROM chirpmsgs
 WHERE id = $1
 `
 
@@ -55,17 +166,290 @@ func (q *Queries) GetChirpById(ctx context.Context, id uuid.UUID) (Chirpmsg, err
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.ReplyToID,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
 	)
 	return i, err
 }
 
-const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirpmsgs
-ORDER BY created_at ASC
+const getChirpsByIDs = `-- name: GetChirpsByIDs :many
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, rechirp_of_id, quote_of_id FROM chirpmsgs
+WHERE id = ANY($1::uuid[])
+`
+
+func (q *Queries) GetChirpsByIDs(ctx context.Context, ids []uuid.UUID) ([]Chirpmsg, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByIDs, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirpmsg
+	for rows.Next() {
+		var i Chirpmsg
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ReplyToID,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpAncestors = `-- name: ListChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT parent.id, parent.created_at, parent.updated_at, parent.body, parent.user_id, parent.reply_to_id, parent.rechirp_of_id, parent.quote_of_id, 1 AS depth FROM chirpmsgs parent
+    WHERE parent.id = (SELECT child.reply_to_id FROM chirpmsgs child WHERE child.id = $1)
+    UNION ALL
+    SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.reply_to_id, c.rechirp_of_id, c.quote_of_id, a.depth + 1 FROM chirpmsgs c
+    JOIN ancestors a ON c.id = a.reply_to_id
+)
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, rechirp_of_id, quote_of_id FROM ancestors
+ORDER BY depth DESC
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirpmsg, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+type ListChirpAncestorsRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Body        string
+	UserID      uuid.UUID
+	ReplyToID   uuid.NullUUID
+	RechirpOfID uuid.NullUUID
+	QuoteOfID   uuid.NullUUID
+}
+
+func (q *Queries) ListChirpAncestors(ctx context.Context, id uuid.UUID) ([]ListChirpAncestorsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpAncestors, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListChirpAncestorsRow
+	for rows.Next() {
+		var i ListChirpAncestorsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ReplyToID,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpDescendants = `-- name: ListChirpDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT id, created_at, updated_at, body, user_id, reply_to_id, rechirp_of_id, quote_of_id FROM chirpmsgs
+    WHERE chirpmsgs.reply_to_id = $1
+    UNION ALL
+    SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.reply_to_id, c.rechirp_of_id, c.quote_of_id FROM chirpmsgs c
+    JOIN descendants d ON c.reply_to_id = d.id
+)
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, rechirp_of_id, quote_of_id FROM descendants
+ORDER BY created_at ASC, id ASC
+`
+
+type ListChirpDescendantsRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Body        string
+	UserID      uuid.UUID
+	ReplyToID   uuid.NullUUID
+	RechirpOfID uuid.NullUUID
+	QuoteOfID   uuid.NullUUID
+}
+
+func (q *Queries) ListChirpDescendants(ctx context.Context, replyToID uuid.NullUUID) ([]ListChirpDescendantsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpDescendants, replyToID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListChirpDescendantsRow
+	for rows.Next() {
+		var i ListChirpDescendantsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ReplyToID,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirps = `-- name: ListChirps :many
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, rechirp_of_id, quote_of_id FROM chirpmsgs
+WHERE ($1::uuid IS NULL OR user_id = $1)
+AND ($2::timestamp IS NULL
+    OR (created_at, id) > ($2, $3::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT $4
+`
+
+type ListChirpsParams struct {
+	AuthorID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	RowLimit        int32
+}
+
+func (q *Queries) ListChirps(ctx context.Context, arg ListChirpsParams) ([]Chirpmsg, error) {
+	rows, err := q.db.QueryContext(ctx, listChirps,
+		arg.AuthorID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirpmsg
+	for rows.Next() {
+		var i Chirpmsg
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ReplyToID,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsDesc = `-- name: ListChirpsDesc :many
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, rechirp_of_id, quote_of_id FROM chirpmsgs
+WHERE ($1::uuid IS NULL OR user_id = $1)
+AND ($2::timestamp IS NULL
+    OR (created_at, id) < ($2, $3::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT $4
+`
+
+type ListChirpsDescParams struct {
+	AuthorID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	RowLimit        int32
+}
+
+func (q *Queries) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirpmsg, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDesc,
+		arg.AuthorID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirpmsg
+	for rows.Next() {
+		var i Chirpmsg
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ReplyToID,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTimeline = `-- name: ListTimeline :many
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, rechirp_of_id, quote_of_id FROM chirpmsgs
+WHERE (user_id = $1
+    OR user_id IN (SELECT followee_id FROM follows WHERE follower_id = $1))
+AND ($2::timestamp IS NULL
+    OR (created_at, id) < ($2, $3::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT $4
+`
+
+type ListTimelineParams struct {
+	ViewerID        uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	RowLimit        int32
+}
+
+func (q *Queries) ListTimeline(ctx context.Context, arg ListTimelineParams) ([]Chirpmsg, error) {
+	rows, err := q.db.QueryContext(ctx, listTimeline,
+		arg.ViewerID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.RowLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -79,6 +463,9 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirpmsg, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.ReplyToID,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
 		); err != nil {
 			return nil, err
 		}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/deoreal/chirpy/internal/dbtest"
+	"github.com/google/uuid"
+)
+
+// TestChirpQueries runs the chirp listing queries against a real database.
+func TestChirpQueries(t *testing.T) {
+	q := New(dbtest.Open(t))
+	ctx := context.Background()
+
+	alice, err := q.CreateUser(ctx, CreateUserParams{Email: "alice@example.com", HashedPassword: "x"})
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	bob, err := q.CreateUser(ctx, CreateUserParams{Email: "bob@example.com", HashedPassword: "x"})
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	root, err := q.CreateChirp(ctx, CreateChirpParams{Body: "root", UserID: alice.ID})
+	if err != nil {
+		t.Fatalf("CreateChirp() error = %v", err)
+	}
+	reply, err := q.CreateChirp(ctx, CreateChirpParams{
+		Body:      "reply",
+		UserID:    bob.ID,
+		ReplyToID: uuid.NullUUID{UUID: root.ID, Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("CreateChirp() error = %v", err)
+	}
+	quote, err := q.CreateChirp(ctx, CreateChirpParams{
+		Body:      "quote",
+		UserID:    bob.ID,
+		QuoteOfID: uuid.NullUUID{UUID: root.ID, Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("CreateChirp() error = %v", err)
+	}
+	rechirp, err := q.CreateRechirp(ctx, CreateRechirpParams{UserID: bob.ID, RechirpOfID: uuid.NullUUID{UUID: root.ID, Valid: true}})
+	if err != nil {
+		t.Fatalf("CreateRechirp() error = %v", err)
+	}
+	if _, err := q.FollowUser(ctx, FollowUserParams{FollowerID: alice.ID, FolloweeID: bob.ID}); err != nil {
+		t.Fatalf("FollowUser() error = %v", err)
+	}
+
+	ids := func(chirps []Chirpmsg) []uuid.UUID {
+		var out []uuid.UUID
+		for _, c := range chirps {
+			out = append(out, c.ID)
+		}
+		return out
+	}
+	all := []uuid.UUID{root.ID, reply.ID, quote.ID, rechirp.ID}
+	newest := []uuid.UUID{rechirp.ID, quote.ID, reply.ID, root.ID}
+
+	t.Run("GetChirpsByIDs", func(t *testing.T) {
+		got, err := q.GetChirpsByIDs(ctx, []uuid.UUID{quote.ID})
+		assertIDs(t, ids(got), err, []uuid.UUID{quote.ID})
+		if err == nil && got[0].QuoteOfID.UUID != root.ID {
+			t.Errorf("QuoteOfID = %v, want %v", got[0].QuoteOfID, root.ID)
+		}
+	})
+	t.Run("ListChirps", func(t *testing.T) {
+		got, err := q.ListChirps(ctx, ListChirpsParams{RowLimit: 10})
+		assertIDs(t, ids(got), err, all)
+	})
+	t.Run("ListChirpsDesc", func(t *testing.T) {
+		got, err := q.ListChirpsDesc(ctx, ListChirpsDescParams{AuthorID: uuid.NullUUID{UUID: bob.ID, Valid: true}, RowLimit: 10})
+		assertIDs(t, ids(got), err, newest[:3])
+	})
+	t.Run("ListTimeline", func(t *testing.T) {
+		got, err := q.ListTimeline(ctx, ListTimelineParams{ViewerID: alice.ID, RowLimit: 10})
+		assertIDs(t, ids(got), err, newest)
+		if err == nil && got[0].RechirpOfID.UUID != root.ID {
+			t.Errorf("RechirpOfID = %v, want %v", got[0].RechirpOfID, root.ID)
+		}
+	})
+	t.Run("ListChirpAncestors", func(t *testing.T) {
+		got, err := q.ListChirpAncestors(ctx, reply.ID)
+		if err != nil || len(got) != 1 || got[0].ID != root.ID {
+			t.Errorf("ListChirpAncestors() = %v, %v; want [root]", got, err)
+		}
+	})
+	t.Run("ListChirpDescendants", func(t *testing.T) {
+		got, err := q.ListChirpDescendants(ctx, uuid.NullUUID{UUID: root.ID, Valid: true})
+		if err != nil || len(got) != 1 || got[0].ID != reply.ID || got[0].ReplyToID.UUID != root.ID {
+			t.Errorf("ListChirpDescendants() = %v, %v; want [reply]", got, err)
+		}
+	})
+}
+
+func assertIDs(t *testing.T, got []uuid.UUID, err error, want []uuid.UUID) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d chirps, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("chirp %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
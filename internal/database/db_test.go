@@ -475,7 +475,7 @@ func TestIntegrationSetup(t *testing.T) {
 		}
 
 		// Test getting all chirps
-		allChirps, err := queries.GetChirps(ctx)
+		allChirps, err := queries.ListChirps(ctx, ListChirpsParams{RowLimit: 100})
 		if err != nil {
 			t.Fatalf("Failed to get all chirps: %v", err)
 		}
@@ -5,23 +5,140 @@
 package database
 
 import (
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type ApiKey struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UserID     uuid.UUID
+	Name       string
+	KeyPrefix  string
+	KeyHash    string
+	Scopes     []string
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
 type Chirpmsg struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Body        string
+	UserID      uuid.UUID
+	ReplyToID   uuid.NullUUID
+	RechirpOfID uuid.NullUUID
+	QuoteOfID   uuid.NullUUID
+}
+
+type FanoutSkip struct {
+	ChirpID   uuid.UUID
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type FollowerCount struct {
+	UserID    uuid.UUID
+	Followers int32
+}
+
+type Like struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type LockoutEvent struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	Kind        string
+	Subject     string
+	Event       string
+	Failures    int32
+	LockedUntil sql.NullTime
+	ActorID     uuid.NullUUID
+}
+
+type LoginFailure struct {
+	Kind          string
+	Subject       string
+	Failures      int32
+	LastFailureAt time.Time
+	LockedUntil   sql.NullTime
+}
+
+type OidcLogin struct {
+	State        string
+	CreatedAt    time.Time
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+type OneTimeToken struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
+	UserID    uuid.UUID
+	Purpose   string
+	Email     string
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	Token     string
+	CreatedAt time.Time
 	UpdatedAt time.Time
-	Body      string
 	UserID    uuid.UUID
+	ExpiresAt time.Time
+	RevokedAt sql.NullTime
+	SessionID uuid.NullUUID
+}
+
+type Session struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	UserID     uuid.UUID
+	UserAgent  string
+	Ip         string
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+}
+
+type TotpRecoveryCode struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	CodeHash  string
+	UsedAt    sql.NullTime
 }
 
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Email           string
+	HashedPassword  string
+	IsChirpyRed     bool
+	EmailVerifiedAt sql.NullTime
+	Role            string
+}
+
+type UserTotp struct {
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Secret    string
+	EnabledAt sql.NullTime
+	LastStep  int64
 }
@@ -0,0 +1,272 @@
+package database
+
+import (
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// generatedQuery is one sqlc query method and what it does with its query.
+type generatedQuery struct {
+	method string
+	query  string
+	call   string   // QueryContext, QueryRowContext or ExecContext
+	args   int      // arguments bound to the query's placeholders
+	scan   []string // Scan destinations, as source text
+}
+
+// TestGeneratedQueriesMatchSQL checks that every query method in the *.sql.go
+// files binds as many arguments as its query has placeholders and scans
+// exactly the columns its query returns, once each. It catches generated code
+// that has drifted from the SQL it embeds without needing a database.
+func TestGeneratedQueriesMatchSQL(t *testing.T) {
+	queries := parseGeneratedQueries(t)
+	if len(queries) == 0 {
+		t.Fatal("found no generated queries")
+	}
+
+	for _, q := range queries {
+		t.Run(q.method, func(t *testing.T) {
+			if got := placeholderCount(q.query); got != q.args {
+				t.Errorf("query has %d placeholders, method binds %d arguments", got, q.args)
+			}
+			if q.call == "ExecContext" {
+				return
+			}
+
+			cols, err := resultColumnCount(q.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cols != len(q.scan) {
+				t.Errorf("query returns %d columns, method scans %d", cols, len(q.scan))
+			}
+			seen := make(map[string]bool)
+			for _, dest := range q.scan {
+				if seen[dest] {
+					t.Errorf("%s is scanned more than once", dest)
+				}
+				seen[dest] = true
+			}
+		})
+	}
+}
+
+func TestResultColumnCount(t *testing.T) {
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{query: "SELECT id, body FROM chirpmsgs WHERE id = $1", want: 2},
+		{query: "SELECT reply_to_id, COUNT(*) AS replies FROM chirpmsgs GROUP BY reply_to_id", want: 2},
+		{query: "UPDATE users SET email = $2, role = 'a,b' WHERE id = $1\nRETURNING id, email, role", want: 3},
+		{query: "WITH RECURSIVE t AS (\n    SELECT id, a, b FROM x\n)\nSELECT id FROM t", want: 1},
+		{query: "SELECT EXISTS (SELECT 1 FROM follows WHERE a = $1 AND b = $2)", want: 1},
+	}
+
+	for _, tt := range tests {
+		got, err := resultColumnCount(tt.query)
+		if err != nil {
+			t.Errorf("resultColumnCount(%q) error = %v", tt.query, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("resultColumnCount(%q) = %d, want %d", tt.query, got, tt.want)
+		}
+	}
+}
+
+func parseGeneratedQueries(t *testing.T) []generatedQuery {
+	t.Helper()
+
+	files, err := filepath.Glob("*.sql.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fset := token.NewFileSet()
+	consts := make(map[string]string)
+	var funcs []*ast.FuncDecl
+	for _, name := range files {
+		f, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, decl := range f.Decls {
+			switch d := decl.(type) {
+			case *ast.GenDecl:
+				if d.Tok != token.CONST {
+					continue
+				}
+				for _, spec := range d.Specs {
+					vs := spec.(*ast.ValueSpec)
+					for i, ident := range vs.Names {
+						lit, ok := vs.Values[i].(*ast.BasicLit)
+						if !ok || lit.Kind != token.STRING {
+							continue
+						}
+						s, err := strconv.Unquote(lit.Value)
+						if err != nil {
+							t.Fatal(err)
+						}
+						consts[ident.Name] = s
+					}
+				}
+			case *ast.FuncDecl:
+				if d.Recv != nil {
+					funcs = append(funcs, d)
+				}
+			}
+		}
+	}
+
+	var queries []generatedQuery
+	for _, fn := range funcs {
+		q := generatedQuery{method: fn.Name.Name}
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			switch sel.Sel.Name {
+			case "QueryContext", "QueryRowContext", "ExecContext":
+				if ident, ok := call.Args[1].(*ast.Ident); ok {
+					q.call = sel.Sel.Name
+					q.query = consts[ident.Name]
+					q.args = len(call.Args) - 2
+				}
+			case "Scan":
+				for _, arg := range call.Args {
+					q.scan = append(q.scan, types.ExprString(arg))
+				}
+			}
+			return true
+		})
+		if q.call == "" {
+			continue
+		}
+		if q.query == "" {
+			t.Fatalf("%s: query constant not found", q.method)
+		}
+		queries = append(queries, q)
+	}
+	return queries
+}
+
+var placeholderRE = regexp.MustCompile(`\$(\d+)`)
+
+// placeholderCount returns the highest $N placeholder in query.
+func placeholderCount(query string) int {
+	n := 0
+	for _, m := range placeholderRE.FindAllStringSubmatch(query, -1) {
+		if i, _ := strconv.Atoi(m[1]); i > n {
+			n = i
+		}
+	}
+	return n
+}
+
+// resultColumnCount returns the number of columns in query's RETURNING list
+// or, failing that, in its last top-level SELECT list.
+func resultColumnCount(query string) (int, error) {
+	// Drop the "-- name:" line sqlc puts at the top of each query.
+	var lines []string
+	for _, line := range strings.Split(query, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			lines = append(lines, line)
+		}
+	}
+	query = strings.Join(lines, "\n")
+
+	type keyword struct {
+		word string
+		pos  int
+	}
+	var keywords []keyword
+	var commas []int
+	depth := 0
+	inString := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case inString:
+			if c == '\'' {
+				inString = false
+			}
+		case c == '\'':
+			inString = true
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && c == ',':
+			commas = append(commas, i)
+		case depth == 0 && isWordStart(query, i):
+			j := i
+			for j < len(query) && isWordByte(query[j]) {
+				j++
+			}
+			keywords = append(keywords, keyword{word: strings.ToUpper(query[i:j]), pos: i})
+			i = j - 1
+		}
+	}
+
+	start, end := -1, len(query)
+	for _, kw := range keywords {
+		if kw.word == "RETURNING" {
+			start = kw.pos + len(kw.word)
+		}
+	}
+	if start < 0 {
+		for i, kw := range keywords {
+			if kw.word != "SELECT" {
+				continue
+			}
+			start, end = kw.pos+len(kw.word), len(query)
+			for _, next := range keywords[i+1:] {
+				if next.word == "FROM" {
+					end = next.pos
+					break
+				}
+			}
+		}
+	}
+	if start < 0 {
+		return 0, errors.New("query has no SELECT or RETURNING list")
+	}
+
+	list := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(query[start:end]), ";"))
+	if list == "*" || strings.HasSuffix(list, ".*") {
+		return 0, errors.New("query selects *, which sqlc should have expanded")
+	}
+	n := 1
+	for _, pos := range commas {
+		if pos > start && pos < end {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func isWordStart(s string, i int) bool {
+	c := s[i]
+	if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+		return false
+	}
+	return i == 0 || !isWordByte(s[i-1]) && s[i-1] != '.' && s[i-1] != '$'
+}
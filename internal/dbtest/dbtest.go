@@ -0,0 +1,104 @@
+// Package dbtest gives tests a freshly migrated Postgres schema of their own.
+package dbtest
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	_ "github.com/lib/pq"
+)
+
+// URLEnv names the environment variable holding the connection string of
+// the database tests may create schemas in.
+const URLEnv = "CHIRPY_TEST_DB_URL"
+
+// Open creates an empty schema in the database named by URLEnv, applies the
+// migrations in sql/schema to it and returns a connection whose search_path
+// is that schema. The schema is dropped when tb finishes. Tests calling Open
+// are skipped if URLEnv is not set.
+func Open(tb testing.TB) *sql.DB {
+	tb.Helper()
+
+	dbURL := os.Getenv(URLEnv)
+	if dbURL == "" {
+		tb.Skipf("%s not set", URLEnv)
+	}
+
+	admin, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		tb.Fatalf("open %s: %v", URLEnv, err)
+	}
+	tb.Cleanup(func() { admin.Close() })
+
+	b := make([]byte, 6)
+	rand.Read(b)
+	schema := "chirpy_test_" + hex.EncodeToString(b)
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		tb.Fatalf("create schema: %v", err)
+	}
+	tb.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			tb.Errorf("drop schema %s: %v", schema, err)
+		}
+	})
+
+	db, err := sql.Open("postgres", withSearchPath(dbURL, schema))
+	if err != nil {
+		tb.Fatalf("open %s: %v", schema, err)
+	}
+	tb.Cleanup(func() { db.Close() })
+
+	for _, path := range migrations(tb) {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if _, err := db.Exec(upSection(string(src))); err != nil {
+			tb.Fatalf("migrate %s: %v", filepath.Base(path), err)
+		}
+	}
+	return db
+}
+
+// withSearchPath adds a search_path run-time parameter to a connection
+// string in either URL or keyword/value form.
+func withSearchPath(dbURL, schema string) string {
+	if u, err := url.Parse(dbURL); err == nil && u.Scheme != "" {
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	return dbURL + " search_path=" + schema
+}
+
+// migrations returns the goose migration files in order.
+func migrations(tb testing.TB) []string {
+	tb.Helper()
+
+	_, file, _, _ := runtime.Caller(0)
+	paths, err := filepath.Glob(filepath.Join(filepath.Dir(file), "..", "..", "sql", "schema", "*.sql"))
+	if err != nil || len(paths) == 0 {
+		tb.Fatalf("no migrations found: %v", err)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// upSection returns the statements between "-- +goose Up" and
+// "-- +goose Down".
+func upSection(src string) string {
+	if _, after, ok := strings.Cut(src, "-- +goose Up"); ok {
+		src = after
+	}
+	up, _, _ := strings.Cut(src, "-- +goose Down")
+	return up
+}
@@ -0,0 +1,129 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers transactional email such as verification and password
+// reset links.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// sendMail is smtp.SendMail, replaced in tests.
+var sendMail = smtp.SendMail
+
+// SMTPMailer sends mail through an SMTP server, authenticating with PLAIN
+// auth when Username is set. From may include a display name; only its
+// address is used as the envelope sender.
+type SMTPMailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (m SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return fmt.Errorf("invalid from address %q: %s", m.From, err)
+	}
+
+	var a smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return fmt.Errorf("invalid smtp address %q: %s", m.Addr, err)
+		}
+		a = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	data, err := format(m.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := sendMail(m.Addr, a, from.Address, []string{msg.To}, data); err != nil {
+		return fmt.Errorf("failed to send mail: %s", err)
+	}
+
+	return nil
+}
+
+// FileMailer writes each message to its own .eml file in Dir, for local
+// development without an SMTP server.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m FileMailer) Send(ctx context.Context, msg Message) error {
+	data, err := format(m.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), uuid.NewString())
+	if err := os.WriteFile(filepath.Join(m.Dir, name), data, 0o600); err != nil {
+		return fmt.Errorf("failed to write mail: %s", err)
+	}
+
+	return nil
+}
+
+// LogMailer prints messages to a logger instead of delivering them.
+type LogMailer struct {
+	Logger *log.Logger
+}
+
+func (m LogMailer) Send(ctx context.Context, msg Message) error {
+	logger := m.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	logger.Printf("mail to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+
+	return nil
+}
+
+// format renders msg as an RFC 5322 message. Header values are checked for
+// line breaks so user supplied addresses cannot inject extra headers.
+func format(from string, msg Message, now time.Time) ([]byte, error) {
+	for _, v := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(v, "\r\n") {
+			return nil, fmt.Errorf("mail header contains a line break")
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return []byte(b.String()), nil
+}
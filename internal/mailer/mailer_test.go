@@ -0,0 +1,101 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	data, err := format("chirpy@example.com", Message{To: "alice@example.com", Subject: "Hi", Body: "line1\nline2"}, now)
+	if err != nil {
+		t.Fatalf("format() error = %v", err)
+	}
+
+	got := string(data)
+	for _, want := range []string{
+		"From: chirpy@example.com\r\n",
+		"To: alice@example.com\r\n",
+		"Subject: Hi\r\n",
+		"Date: Thu, 02 Jan 2025 03:04:05 +0000\r\n",
+		"\r\n\r\nline1\r\nline2",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("format() output missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestFormatRejectsHeaderInjection(t *testing.T) {
+	tests := []Message{
+		{To: "alice@example.com\r\nBcc: eve@example.com", Subject: "Hi"},
+		{To: "alice@example.com", Subject: "Hi\nBcc: eve@example.com"},
+	}
+
+	for _, msg := range tests {
+		if _, err := format("chirpy@example.com", msg, time.Now()); err == nil {
+			t.Errorf("format(%q) expected error but got none", msg.To+msg.Subject)
+		}
+	}
+}
+
+func TestSMTPMailerEnvelopeSender(t *testing.T) {
+	var gotFrom string
+	var gotData []byte
+	sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		gotFrom, gotData = from, msg
+		return nil
+	}
+	t.Cleanup(func() { sendMail = smtp.SendMail })
+
+	m := SMTPMailer{Addr: "localhost:25", From: "Chirpy <no-reply@chirpy.local>"}
+	if err := m.Send(context.Background(), Message{To: "alice@example.com", Subject: "Verify", Body: "token"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if gotFrom != "no-reply@chirpy.local" {
+		t.Errorf("envelope sender = %q, want %q", gotFrom, "no-reply@chirpy.local")
+	}
+	if !strings.Contains(string(gotData), "From: Chirpy <no-reply@chirpy.local>\r\n") {
+		t.Errorf("From header missing display name:\n%s", gotData)
+	}
+
+	m.From = "not an address"
+	if err := m.Send(context.Background(), Message{To: "alice@example.com", Subject: "Verify"}); err == nil {
+		t.Error("Send() with an invalid From expected error but got none")
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m := FileMailer{Dir: dir, From: "chirpy@example.com"}
+
+	if err := m.Send(context.Background(), Message{To: "alice@example.com", Subject: "Verify", Body: "token"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	if len(entries) != 1 || !strings.HasSuffix(entries[0].Name(), ".eml") {
+		t.Fatalf("expected one .eml file, got %v", entries)
+	}
+}
+
+func TestLogMailer(t *testing.T) {
+	var buf bytes.Buffer
+	m := LogMailer{Logger: log.New(&buf, "", 0)}
+
+	if err := m.Send(context.Background(), Message{To: "alice@example.com", Subject: "Verify", Body: "token"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "alice@example.com") || !strings.Contains(buf.String(), "token") {
+		t.Errorf("LogMailer wrote %q", buf.String())
+	}
+}
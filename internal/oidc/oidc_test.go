@@ -0,0 +1,364 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeProvider is a minimal in-process OpenID provider. Tests "log in" by
+// calling authorize with the parameters from AuthCodeURL, which returns the
+// code the provider would have redirected back with.
+type fakeProvider struct {
+	t      *testing.T
+	srv    *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+	secret string
+
+	mu    sync.Mutex
+	codes map[string]fakeGrant
+	// claims, if set, adjusts the ID token before it is signed.
+	claims func(jwt.MapClaims)
+}
+
+type fakeGrant struct {
+	challenge string
+	nonce     string
+	redirect  string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProvider{t: t, key: key, kid: "k1", secret: "s3cret", codes: map[string]fakeGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Provider{
+			Issuer:                p.srv.URL,
+			AuthorizationEndpoint: p.srv.URL + "/authorize",
+			TokenEndpoint:         p.srv.URL + "/token",
+			JWKSURI:               p.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]any{"keys": []jsonWebKey{{
+			Kty: "RSA",
+			Kid: p.kid,
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", p.token)
+	p.srv = httptest.NewServer(mux)
+	t.Cleanup(p.srv.Close)
+
+	return p
+}
+
+func (p *fakeProvider) client(t *testing.T) *Client {
+	t.Helper()
+	c, err := NewClient(Config{
+		Issuer:       p.srv.URL,
+		ClientID:     "chirpy",
+		ClientSecret: p.secret,
+		RedirectURL:  "http://chirpy.test/api/oidc/callback",
+		HTTPClient:   p.srv.Client(),
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return c
+}
+
+// authorize plays the user approving the login at authURL.
+func (p *fakeProvider) authorize(authURL string) (code, state string) {
+	p.t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" || q.Get("client_id") != "chirpy" {
+		p.t.Fatalf("unexpected authorization request %s", authURL)
+	}
+	if !strings.Contains(q.Get("scope"), "openid") {
+		p.t.Fatalf("scope %q does not include openid", q.Get("scope"))
+	}
+
+	code = "code-" + q.Get("state")
+	p.mu.Lock()
+	p.codes[code] = fakeGrant{challenge: q.Get("code_challenge"), nonce: q.Get("nonce"), redirect: q.Get("redirect_uri")}
+	p.mu.Unlock()
+
+	return code, q.Get("state")
+}
+
+func (p *fakeProvider) token(w http.ResponseWriter, r *http.Request) {
+	fail := func(e string) {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(map[string]string{"error": e})
+	}
+	if id, secret, ok := r.BasicAuth(); !ok || id != "chirpy" || secret != p.secret {
+		w.WriteHeader(401)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		fail("invalid_request")
+		return
+	}
+
+	p.mu.Lock()
+	grant, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+	if !ok || grant.redirect != r.PostForm.Get("redirect_uri") {
+		fail("invalid_grant")
+		return
+	}
+	if CodeChallenge(r.PostForm.Get("code_verifier")) != grant.challenge {
+		fail("invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            p.srv.URL,
+		"sub":            "user-123",
+		"aud":            "chirpy",
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Minute).Unix(),
+		"nonce":          grant.nonce,
+		"email":          "sso@example.com",
+		"email_verified": true,
+	}
+	if p.claims != nil {
+		p.claims(claims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	p.mu.Lock()
+	token.Header["kid"] = p.kid
+	signed, err := token.SignedString(p.key)
+	p.mu.Unlock()
+	if err != nil {
+		p.t.Errorf("signing id token: %v", err)
+		fail("server_error")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": signed})
+}
+
+// login runs the whole flow and returns the result of Exchange.
+func login(t *testing.T, c *Client, p *fakeProvider, exchangeVerifier, exchangeNonce func(string) string) (*IDToken, error) {
+	t.Helper()
+	ctx := context.Background()
+	state, _ := NewState()
+	nonce, _ := NewState()
+	verifier, _ := NewState()
+
+	authURL, err := c.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	code, gotState := p.authorize(authURL)
+	if gotState != state {
+		t.Fatalf("state = %q, want %q", gotState, state)
+	}
+
+	if exchangeVerifier != nil {
+		verifier = exchangeVerifier(verifier)
+	}
+	if exchangeNonce != nil {
+		nonce = exchangeNonce(nonce)
+	}
+
+	return c.Exchange(ctx, code, verifier, nonce)
+}
+
+func TestLogin(t *testing.T) {
+	p := newFakeProvider(t)
+	c := p.client(t)
+
+	tok, err := login(t, c, p, nil, nil)
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	if tok.Subject != "user-123" || tok.Email != "sso@example.com" || !tok.EmailVerified || tok.Issuer != p.srv.URL {
+		t.Errorf("Exchange() = %+v", tok)
+	}
+}
+
+func TestLoginRejects(t *testing.T) {
+	wrong := func(string) string { return "wrong" }
+
+	tests := []struct {
+		name     string
+		claims   func(jwt.MapClaims)
+		verifier func(string) string
+		nonce    func(string) string
+	}{
+		{name: "wrong code verifier", verifier: wrong},
+		{name: "wrong nonce", nonce: wrong},
+		{name: "other audience", claims: func(c jwt.MapClaims) { c["aud"] = "someone-else" }},
+		{name: "other issuer", claims: func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }},
+		{name: "expired", claims: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{name: "no subject", claims: func(c jwt.MapClaims) { delete(c, "sub") }},
+		{
+			name:   "shared audience without azp",
+			claims: func(c jwt.MapClaims) { c["aud"] = []string{"chirpy", "other"} },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newFakeProvider(t)
+			p.claims = tt.claims
+			c := p.client(t)
+
+			if tok, err := login(t, c, p, tt.verifier, tt.nonce); err == nil {
+				t.Errorf("Exchange() = %+v, want error", tok)
+			}
+		})
+	}
+}
+
+func TestLoginRejectsWrongClientSecret(t *testing.T) {
+	p := newFakeProvider(t)
+	c := p.client(t)
+	p.secret = "rotated"
+
+	if _, err := login(t, c, p, nil, nil); err == nil || !strings.Contains(err.Error(), "invalid_client") {
+		t.Errorf("Exchange() error = %v, want invalid_client", err)
+	}
+}
+
+func TestVerifyRejectsForgedSignature(t *testing.T) {
+	p := newFakeProvider(t)
+	c := p.client(t)
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": p.srv.URL, "sub": "user-123", "aud": "chirpy", "nonce": "n",
+		"iat": time.Now().Unix(), "exp": time.Now().Add(time.Minute).Unix(),
+	})
+	token.Header["kid"] = p.kid
+	forged, err := token.SignedString(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Verify(context.Background(), forged, "n"); err == nil {
+		t.Error("Verify() accepted a token signed with another key")
+	}
+
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, token.Claims)
+	hs.Header["kid"] = p.kid
+	hsToken, err := hs.SignedString([]byte("chirpy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Verify(context.Background(), hsToken, "n"); err == nil {
+		t.Error("Verify() accepted an HS256 token")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	p := newFakeProvider(t)
+	c := p.client(t)
+
+	if _, err := login(t, c, p, nil, nil); err != nil {
+		t.Fatalf("first login error = %v", err)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.mu.Lock()
+	p.key, p.kid = key, "k2"
+	p.mu.Unlock()
+
+	if _, err := login(t, c, p, nil, nil); err != nil {
+		t.Errorf("login after rotation error = %v", err)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	p := newFakeProvider(t)
+	c, err := NewClient(Config{
+		Issuer:      p.srv.URL + "/tenant",
+		ClientID:    "chirpy",
+		RedirectURL: "http://chirpy.test/api/oidc/callback",
+		HTTPClient:  p.srv.Client(),
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	if _, err := c.AuthCodeURL(context.Background(), "s", "n", "v"); err == nil {
+		t.Error("AuthCodeURL() succeeded against a provider with another issuer")
+	}
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// Example from RFC 7636, appendix B.
+	got := CodeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"; got != want {
+		t.Errorf("CodeChallenge() = %q, want %q", got, want)
+	}
+}
+
+func TestECKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := key.PublicKey.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk := jsonWebKey{
+		Kty: "EC",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(pub[1:33]),
+		Y:   base64.RawURLEncoding.EncodeToString(pub[33:]),
+	}
+	got, err := jwk.publicKey()
+	if err != nil {
+		t.Fatalf("publicKey() error = %v", err)
+	}
+	if !key.PublicKey.Equal(got) {
+		t.Error("publicKey() returned a different key")
+	}
+
+	jwk.Y = jwk.X
+	if _, err := jwk.publicKey(); err == nil {
+		t.Error("publicKey() accepted a point that is not on the curve")
+	}
+}
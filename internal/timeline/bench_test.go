@@ -0,0 +1,75 @@
+package timeline
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// The benchmarks compare the in-memory cost of serving the first page of a
+// home timeline for a reader following many authors: merging every followed
+// author's recent chirps on each request, against slicing a timeline that
+// was built by fan-out on write. They leave out the database;
+// BenchmarkTimelineEntries in package main measures the ListTimeline query
+// against the cache.
+
+const (
+	benchPage         = 20
+	benchAuthorChirps = 50
+)
+
+func benchAuthors(n int) [][]Entry {
+	authors := make([][]Entry, n)
+	for i := range authors {
+		authors[i] = entries(uuid.New(), benchAuthorChirps, i)
+	}
+	return authors
+}
+
+func BenchmarkTimelineRead(b *testing.B) {
+	for _, following := range []int{10, 100, 1000} {
+		authors := benchAuthors(following)
+
+		b.Run(fmt.Sprintf("merge-in-memory/following=%d", following), func(b *testing.B) {
+			for b.Loop() {
+				Merge(benchPage, authors...)
+			}
+		})
+
+		b.Run(fmt.Sprintf("cached-page/following=%d", following), func(b *testing.B) {
+			c := NewCache(1, 500)
+			reader := uuid.New()
+			c.Fill(reader, Merge(c.MaxEntries(), authors...))
+			for b.Loop() {
+				if _, ok := c.Page(reader, nil, benchPage); !ok {
+					b.Fatal("timeline not cached")
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkTimelineWrite is the price fan-out-on-write pays instead: one
+// insert per follower with a warm timeline for every chirp posted.
+func BenchmarkTimelineWrite(b *testing.B) {
+	for _, followers := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("followers=%d", followers), func(b *testing.B) {
+			c := NewCache(followers, 500)
+			readers := make([]uuid.UUID, followers)
+			for i := range readers {
+				readers[i] = uuid.New()
+				c.Fill(readers[i], entries(uuid.New(), 100, 0))
+			}
+			author := uuid.New()
+			i := 0
+			for b.Loop() {
+				i++
+				e := entries(author, 1, 1000+i)[0]
+				for _, r := range readers {
+					c.Push(r, e)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+// Package timeline keeps materialized home timelines in memory so that
+// reading a timeline does not have to join across everyone the reader
+// follows.
+package timeline
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Entry is one chirp on a timeline. Timelines are ordered newest first by
+// (CreatedAt, ChirpID), the same keyset the chirp listings paginate on.
+type Entry struct {
+	ChirpID   uuid.UUID
+	AuthorID  uuid.UUID
+	CreatedAt time.Time
+}
+
+// Before reports whether e sorts after (is older than) the position
+// createdAt, id.
+func (e Entry) Before(createdAt time.Time, id uuid.UUID) bool {
+	if !e.CreatedAt.Equal(createdAt) {
+		return e.CreatedAt.Before(createdAt)
+	}
+	return uuidLess(e.ChirpID, id)
+}
+
+func uuidLess(a, b uuid.UUID) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+// newer reports whether a sorts before b on a timeline.
+func newer(a, b Entry) bool {
+	return b.Before(a.CreatedAt, a.ChirpID)
+}
+
+// Cache holds up to maxUsers timelines of at most maxEntries each,
+// evicting the least recently read timeline when full.
+type Cache struct {
+	maxUsers   int
+	maxEntries int
+
+	mu      sync.Mutex
+	lru     *list.List
+	users   map[uuid.UUID]*list.Element
+	pending map[uuid.UUID]*pendingFill
+}
+
+// pendingFill tracks the loads of a timeline that is not cached yet.
+type pendingFill struct {
+	// loads counts BeginFill calls not yet ended by Fill or CancelFill.
+	loads int
+	// pushed holds entries pushed while loading, which the rows being
+	// loaded may have been read too early to include.
+	pushed []Entry
+	// dropped is set by Drop; the rows being loaded may be stale.
+	dropped bool
+}
+
+type userTimeline struct {
+	userID  uuid.UUID
+	entries []Entry
+	// complete is true while entries hold the user's entire timeline,
+	// so a page past the oldest entry is known to be empty rather than
+	// merely not cached.
+	complete bool
+}
+
+func NewCache(maxUsers, maxEntries int) *Cache {
+	return &Cache{
+		maxUsers:   maxUsers,
+		maxEntries: maxEntries,
+		lru:        list.New(),
+		users:      map[uuid.UUID]*list.Element{},
+		pending:    map[uuid.UUID]*pendingFill{},
+	}
+}
+
+// MaxEntries is the most entries kept per timeline; Fill callers load
+// this many rows.
+func (c *Cache) MaxEntries() int {
+	return c.maxEntries
+}
+
+// BeginFill is called before loading userID's timeline from the database
+// for Fill. Until the matching Fill, entries pushed to userID are kept even
+// though the timeline is not cached, and a Drop makes that Fill a no-op.
+// Every BeginFill must be ended by Fill or CancelFill.
+func (c *Cache) BeginFill(userID uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.pending[userID]
+	if !ok {
+		p = &pendingFill{}
+		c.pending[userID] = p
+	}
+	p.loads++
+}
+
+// CancelFill ends a BeginFill whose load failed.
+func (c *Cache) CancelFill(userID uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.endFill(userID)
+}
+
+// Fill caches userID's timeline as loaded from the database, newest
+// first, together with anything pushed since BeginFill.
+func (c *Cache) Fill(userID uuid.UUID, entries []Entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p := c.endFill(userID)
+	if p != nil && p.dropped {
+		return
+	}
+
+	t := &userTimeline{userID: userID, complete: len(entries) < c.maxEntries}
+	if el, ok := c.users[userID]; ok {
+		t = el.Value.(*userTimeline)
+		c.lru.MoveToFront(el)
+		t.complete = t.complete || len(entries) < c.maxEntries
+	} else {
+		c.users[userID] = c.lru.PushFront(t)
+		c.evict()
+	}
+	for _, e := range entries {
+		c.insert(t, e)
+	}
+	if p != nil {
+		for _, e := range p.pushed {
+			c.insert(t, e)
+		}
+	}
+}
+
+// endFill ends one load of userID's timeline and returns its pending
+// state, or nil if BeginFill was not called.
+func (c *Cache) endFill(userID uuid.UUID) *pendingFill {
+	p, ok := c.pending[userID]
+	if !ok {
+		return nil
+	}
+	p.loads--
+	if p.loads == 0 {
+		delete(c.pending, userID)
+	}
+	return p
+}
+
+// Push adds e to userID's timeline if it is cached or being loaded. Other
+// timelines are left alone; they are loaded in full on the next read.
+func (c *Cache) Push(userID uuid.UUID, e Entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.users[userID]; ok {
+		c.insert(el.Value.(*userTimeline), e)
+		return
+	}
+	if p, ok := c.pending[userID]; ok {
+		if len(p.pushed) == c.maxEntries {
+			p.pushed = p.pushed[1:]
+		}
+		p.pushed = append(p.pushed, e)
+	}
+}
+
+// Drop forgets userID's timeline, e.g. after they follow or unfollow
+// someone.
+func (c *Cache) Drop(userID uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.users[userID]; ok {
+		c.lru.Remove(el)
+		delete(c.users, userID)
+	}
+	if p, ok := c.pending[userID]; ok {
+		p.dropped = true
+	}
+}
+
+// Page returns up to limit entries of userID's timeline older than the
+// cursor, or the newest entries if cursor is nil. ok is false when the
+// timeline is not cached or the page reaches past what is cached, in which
+// case the caller must read from the database.
+func (c *Cache) Page(userID uuid.UUID, cursor *Entry, limit int) (page []Entry, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, found := c.users[userID]
+	if !found {
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	t := el.Value.(*userTimeline)
+
+	start := 0
+	if cursor != nil {
+		for start < len(t.entries) && !t.entries[start].Before(cursor.CreatedAt, cursor.ChirpID) {
+			start++
+		}
+	}
+	end := min(start+limit, len(t.entries))
+	if end-start < limit && !t.complete {
+		return nil, false
+	}
+
+	return append([]Entry(nil), t.entries[start:end]...), true
+}
+
+// Len returns the number of cached timelines.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.users)
+}
+
+// insert places e in order, ignoring duplicates, and trims the timeline
+// to maxEntries.
+func (c *Cache) insert(t *userTimeline, e Entry) {
+	i := 0
+	for i < len(t.entries) && newer(t.entries[i], e) {
+		i++
+	}
+	if i < len(t.entries) && t.entries[i].ChirpID == e.ChirpID {
+		return
+	}
+	if i == len(t.entries) && len(t.entries) >= c.maxEntries {
+		// Older than everything kept; we already know the timeline is
+		// not complete.
+		t.complete = false
+		return
+	}
+
+	t.entries = append(t.entries, Entry{})
+	copy(t.entries[i+1:], t.entries[i:])
+	t.entries[i] = e
+	if len(t.entries) > c.maxEntries {
+		t.entries = t.entries[:c.maxEntries]
+		t.complete = false
+	}
+}
+
+func (c *Cache) evict() {
+	for len(c.users) > c.maxUsers {
+		el := c.lru.Back()
+		c.lru.Remove(el)
+		delete(c.users, el.Value.(*userTimeline).userID)
+	}
+}
+
+// Merge combines timelines that are each ordered newest first into one,
+// dropping duplicates, and returns at most limit entries.
+func Merge(limit int, timelines ...[]Entry) []Entry {
+	pos := make([]int, len(timelines))
+	seen := map[uuid.UUID]bool{}
+	var out []Entry
+	for len(out) < limit {
+		best := -1
+		for i, t := range timelines {
+			if pos[i] < len(t) && (best < 0 || newer(t[pos[i]], timelines[best][pos[best]])) {
+				best = i
+			}
+		}
+		if best < 0 {
+			break
+		}
+		e := timelines[best][pos[best]]
+		pos[best]++
+		if !seen[e.ChirpID] {
+			seen[e.ChirpID] = true
+			out = append(out, e)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,211 @@
+package timeline
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var epoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// entries returns n entries by author, newest first, the newest at
+// epoch+offset+n seconds.
+func entries(author uuid.UUID, n, offset int) []Entry {
+	out := make([]Entry, n)
+	for i := range out {
+		out[i] = Entry{ChirpID: uuid.New(), AuthorID: author, CreatedAt: epoch.Add(time.Duration(offset+n-i) * time.Second)}
+	}
+	return out
+}
+
+func ids(es []Entry) []uuid.UUID {
+	out := make([]uuid.UUID, len(es))
+	for i, e := range es {
+		out[i] = e.ChirpID
+	}
+	return out
+}
+
+func equalIDs(a, b []Entry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ChirpID != b[i].ChirpID {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCachePage(t *testing.T) {
+	c := NewCache(10, 100)
+	user := uuid.New()
+
+	if _, ok := c.Page(user, nil, 10); ok {
+		t.Fatal("Page() on a cold timeline returned ok")
+	}
+
+	all := entries(uuid.New(), 25, 0)
+	c.Fill(user, all)
+
+	page, ok := c.Page(user, nil, 10)
+	if !ok || !equalIDs(page, all[:10]) {
+		t.Fatalf("first page = %v, %v; want %v", ids(page), ok, ids(all[:10]))
+	}
+	page, ok = c.Page(user, &page[9], 10)
+	if !ok || !equalIDs(page, all[10:20]) {
+		t.Fatalf("second page = %v, %v; want %v", ids(page), ok, ids(all[10:20]))
+	}
+	page, ok = c.Page(user, &page[9], 10)
+	if !ok || !equalIDs(page, all[20:]) {
+		t.Fatalf("last page = %v, %v; want %v", ids(page), ok, ids(all[20:]))
+	}
+}
+
+func TestCachePageBeyondTruncatedTimeline(t *testing.T) {
+	c := NewCache(10, 10)
+	user := uuid.New()
+
+	// A full load means older entries may exist in the database.
+	all := entries(uuid.New(), 10, 0)
+	c.Fill(user, all)
+
+	if _, ok := c.Page(user, nil, 10); !ok {
+		t.Error("Page() within the cached entries returned !ok")
+	}
+	if _, ok := c.Page(user, &all[4], 10); ok {
+		t.Error("Page() past the cached entries of a truncated timeline returned ok")
+	}
+}
+
+func TestCachePush(t *testing.T) {
+	c := NewCache(10, 3)
+	user := uuid.New()
+	author := uuid.New()
+
+	c.Push(user, entries(author, 1, 100)[0])
+	if c.Len() != 0 {
+		t.Fatal("Push() cached a cold timeline")
+	}
+
+	c.Fill(user, nil)
+	old := entries(author, 2, 0)
+	c.Push(user, old[1])
+	c.Push(user, old[0])
+	c.Push(user, old[0])
+	page, ok := c.Page(user, nil, 10)
+	if !ok || !equalIDs(page, old) {
+		t.Fatalf("after pushes page = %v, %v; want %v", ids(page), ok, ids(old))
+	}
+
+	fresh := entries(author, 2, 10)
+	c.Push(user, fresh[1])
+	c.Push(user, fresh[0])
+	page, ok = c.Page(user, nil, 3)
+	want := []Entry{fresh[0], fresh[1], old[0]}
+	if !ok || !equalIDs(page, want) {
+		t.Fatalf("after trimming page = %v, %v; want %v", ids(page), ok, ids(want))
+	}
+	if _, ok := c.Page(user, nil, 4); ok {
+		t.Error("Page() returned ok for a timeline that lost entries to trimming")
+	}
+}
+
+func TestCacheFillKeepsPushesWhileLoading(t *testing.T) {
+	c := NewCache(10, 10)
+	user := uuid.New()
+	author := uuid.New()
+	all := entries(author, 3, 0)
+
+	// all[0] is posted after the database was read but before Fill.
+	c.BeginFill(user)
+	loaded := all[1:]
+	c.Push(user, all[0])
+	c.Fill(user, loaded)
+
+	page, ok := c.Page(user, nil, 10)
+	if !ok || !equalIDs(page, all) {
+		t.Fatalf("page = %v, %v; want %v", ids(page), ok, ids(all))
+	}
+
+	other := uuid.New()
+	c.BeginFill(other)
+	c.CancelFill(other)
+	c.Push(other, all[0])
+	c.Fill(other, nil)
+	if page, _ := c.Page(other, nil, 10); len(page) != 0 {
+		t.Errorf("push after CancelFill was kept: %v", ids(page))
+	}
+}
+
+func TestCacheFillAfterDrop(t *testing.T) {
+	c := NewCache(10, 10)
+	user := uuid.New()
+
+	// The user follows someone while their timeline is being loaded, so
+	// the loaded rows may be missing that author's chirps.
+	c.BeginFill(user)
+	c.Drop(user)
+	c.Fill(user, entries(uuid.New(), 3, 0))
+
+	if _, ok := c.Page(user, nil, 10); ok {
+		t.Error("Fill() cached a timeline dropped while it was loading")
+	}
+
+	c.BeginFill(user)
+	c.Fill(user, nil)
+	if _, ok := c.Page(user, nil, 10); !ok {
+		t.Error("a later fill was not cached")
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	c := NewCache(2, 10)
+	a, b, d := uuid.New(), uuid.New(), uuid.New()
+
+	c.Fill(a, nil)
+	c.Fill(b, nil)
+	c.Page(a, nil, 1)
+	c.Fill(d, nil)
+
+	if _, ok := c.Page(b, nil, 1); ok {
+		t.Error("least recently read timeline was not evicted")
+	}
+	if _, ok := c.Page(a, nil, 1); !ok {
+		t.Error("recently read timeline was evicted")
+	}
+	c.Drop(a)
+	if c.Len() != 1 {
+		t.Errorf("Len() = %d after Drop, want 1", c.Len())
+	}
+}
+
+func TestMerge(t *testing.T) {
+	x := entries(uuid.New(), 3, 0)  // seconds 1-3
+	y := entries(uuid.New(), 3, 10) // seconds 11-13
+	z := []Entry{x[0], y[2]}        // duplicates
+
+	got := Merge(10, x, y, z)
+	want := append(append([]Entry{}, y...), x...)
+	if !equalIDs(got, want) {
+		t.Errorf("Merge() = %v, want %v", ids(got), ids(want))
+	}
+
+	if got := Merge(2, x, y); !equalIDs(got, y[:2]) {
+		t.Errorf("Merge(2) = %v, want %v", ids(got), ids(y[:2]))
+	}
+}
+
+func TestEntryBeforeTieBreak(t *testing.T) {
+	lo := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+	hi := uuid.MustParse("00000000-0000-0000-0000-000000000002")
+
+	if !(Entry{ChirpID: lo, CreatedAt: epoch}).Before(epoch, hi) {
+		t.Error("entry with the same time and a lower id should sort after the cursor")
+	}
+	if (Entry{ChirpID: hi, CreatedAt: epoch}).Before(epoch, hi) {
+		t.Error("an entry is not before its own position")
+	}
+}
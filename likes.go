@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/deoreal/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// chirpTarget returns the chirp named by the chirpID path value, writing a
+// 404 if it is malformed.
+func chirpTarget(w http.ResponseWriter, req *http.Request) (uuid.UUID, bool) {
+	chirpID, err := uuid.Parse(req.PathValue("chirpID"))
+	if err != nil {
+		w.WriteHeader(404)
+		js, _ := json.Marshal(jsonError{Error: "Chirp not found"})
+		w.Write(js)
+		return uuid.UUID{}, false
+	}
+	return chirpID, true
+}
+
+// likeChirp is idempotent: liking a chirp twice is not an error.
+func (cfg *apiConfig) likeChirp(w http.ResponseWriter, req *http.Request) {
+	userID, _ := userIDFromContext(req.Context())
+	chirpID, ok := chirpTarget(w, req)
+	if !ok {
+		return
+	}
+
+	_, err := cfg.dbQueries.LikeChirp(req.Context(), database.LikeChirpParams{UserID: userID, ChirpID: chirpID})
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			w.WriteHeader(404)
+			js, _ := json.Marshal(jsonError{Error: "Chirp not found"})
+			w.Write(js)
+			return
+		}
+		log.Printf("Error liking chirp %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// unlikeChirp is idempotent like likeChirp.
+func (cfg *apiConfig) unlikeChirp(w http.ResponseWriter, req *http.Request) {
+	userID, _ := userIDFromContext(req.Context())
+	chirpID, ok := chirpTarget(w, req)
+	if !ok {
+		return
+	}
+
+	_, err := cfg.dbQueries.UnlikeChirp(req.Context(), database.UnlikeChirpParams{UserID: userID, ChirpID: chirpID})
+	if err != nil {
+		log.Printf("Error unliking chirp %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	w.WriteHeader(204)
+}
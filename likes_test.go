@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestMiddlewareOptionalAuth(t *testing.T) {
+	keys, err := loadKeyring("", "", "", "test_secret_key")
+	if err != nil {
+		t.Fatalf("loadKeyring() error = %v", err)
+	}
+	cfg := &apiConfig{JWTKeys: keys}
+
+	userID := uuid.New()
+	token, err := keys.MakeJWT(userID, "user", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		header   string
+		wantUser bool
+	}{
+		{name: "anonymous", header: ""},
+		{name: "invalid token", header: "Bearer not.a.jwt"},
+		{name: "valid token", header: "Bearer " + token, wantUser: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got uuid.UUID
+			var ok bool
+			h := cfg.middlewareOptionalAuth(scopeChirpsRead, func(w http.ResponseWriter, r *http.Request) {
+				got, ok = userIDFromContext(r.Context())
+				w.WriteHeader(200)
+			})
+
+			req := httptest.NewRequest("GET", "/api/chirps", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != 200 {
+				t.Errorf("status = %d, want 200", rec.Code)
+			}
+			if ok != tt.wantUser {
+				t.Errorf("user in context = %v, want %v", ok, tt.wantUser)
+			}
+			if tt.wantUser && got != userID {
+				t.Errorf("user ID in context = %v, want %v", got, userID)
+			}
+		})
+	}
+}
+
+func TestLikes(t *testing.T) {
+	cfg := newDBConfig(t)
+	alice := createTestUser(t, cfg, "alice@example.com")
+	bob := createTestUser(t, cfg, "bob@example.com")
+
+	chirp, code := postChirp(t, cfg, alice, ChirpyMessage{Body: "like me"})
+	if code != 201 {
+		t.Fatalf("addChirp status = %d, want 201", code)
+	}
+
+	call := func(h http.HandlerFunc, userID, chirpID uuid.UUID) int {
+		t.Helper()
+		req := requestAs(userID, "PUT", "/api/chirps/x/like", "")
+		req.SetPathValue("chirpID", chirpID.String())
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec.Code
+	}
+	for _, userID := range []uuid.UUID{bob, bob, alice} {
+		if code := call(cfg.likeChirp, userID, chirp.ID); code != 204 {
+			t.Fatalf("likeChirp status = %d, want 204", code)
+		}
+	}
+	if code := call(cfg.likeChirp, bob, uuid.New()); code != 404 {
+		t.Errorf("liking a missing chirp: status = %d, want 404", code)
+	}
+
+	getChirp := func(userID uuid.UUID) Chirp {
+		t.Helper()
+		req := requestAs(userID, "GET", "/api/chirps/x", "")
+		req.SetPathValue("chirpID", chirp.ID.String())
+		rec := httptest.NewRecorder()
+		cfg.getChirp(rec, req)
+		var got Chirp
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || rec.Code != 200 {
+			t.Fatalf("getChirp = %d %s", rec.Code, rec.Body)
+		}
+		return got
+	}
+	if got := getChirp(bob); got.LikeCount != 2 || !got.LikedByMe {
+		t.Errorf("as bob: like_count = %d, liked_by_me = %v; want 2, true", got.LikeCount, got.LikedByMe)
+	}
+	if got := getChirp(uuid.Nil); got.LikeCount != 2 || got.LikedByMe {
+		t.Errorf("anonymous: like_count = %d, liked_by_me = %v; want 2, false", got.LikeCount, got.LikedByMe)
+	}
+
+	for range 2 {
+		if code := call(cfg.unlikeChirp, bob, chirp.ID); code != 204 {
+			t.Fatalf("unlikeChirp status = %d, want 204", code)
+		}
+	}
+	if got := getChirp(bob); got.LikeCount != 1 || got.LikedByMe {
+		t.Errorf("after unlike: like_count = %d, liked_by_me = %v; want 1, false", got.LikeCount, got.LikedByMe)
+	}
+}
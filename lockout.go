@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/deoreal/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Failed logins are tracked per account (by email, so unknown emails are
+// throttled too) and per client IP. After loginBackoffAfter failures each
+// further attempt has to wait exponentially longer; at loginLockoutAfter
+// an account is locked out and the lockout is recorded in lockout_events.
+// IPs only ever back off, up to loginIPMaxDelay: many users can share an
+// address behind NAT, and a hard lockout there would let one attacker lock
+// all of them out.
+const (
+	loginKindAccount = "account"
+	loginKindIP      = "ip"
+
+	loginBackoffAfter    = 3
+	loginLockoutAfter    = 10
+	loginLockoutDuration = 15 * time.Minute
+	loginMaxLockout      = 24 * time.Hour
+	loginIPMaxDelay      = time.Minute
+)
+
+// loginDelay returns how long a subject with the given number of
+// consecutive failures must wait after its last failure.
+func loginDelay(failures int32) time.Duration {
+	var d time.Duration
+	switch {
+	case failures < loginBackoffAfter:
+		return 0
+	case failures < loginLockoutAfter:
+		d = time.Second * time.Duration(math.Pow(2, float64(failures-loginBackoffAfter)))
+	default:
+		d = loginLockoutDuration * time.Duration(math.Pow(2, math.Min(float64(failures-loginLockoutAfter), 16)))
+	}
+
+	return min(d, loginMaxLockout)
+}
+
+func loginBlockedUntil(f database.LoginFailure) time.Time {
+	if f.Kind == loginKindIP {
+		return f.LastFailureAt.Add(min(loginDelay(f.Failures), loginIPMaxDelay))
+	}
+
+	until := f.LastFailureAt.Add(loginDelay(f.Failures))
+	if f.LockedUntil.Valid && f.LockedUntil.Time.After(until) {
+		until = f.LockedUntil.Time
+	}
+
+	return until
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// clientIP returns the address of the client. That is the host part of
+// the connection's remote address unless the connection comes from one of
+// the trusted proxies, in which case X-Forwarded-For is read from the right
+// and the first address not belonging to a trusted proxy is used. The
+// header is ignored otherwise because clients can set it freely.
+func clientIP(req *http.Request, trusted []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	if !isTrustedProxy(host, trusted) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		host = hop
+		if !isTrustedProxy(hop, trusted) {
+			break
+		}
+	}
+
+	return host
+}
+
+func isTrustedProxy(host string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseTrustedProxies parses TRUSTED_PROXIES, a comma separated list of
+// addresses and CIDR ranges of reverse proxies whose X-Forwarded-For
+// header can be believed.
+func parseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			p, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q", entry)
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q", entry)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	return prefixes, nil
+}
+
+// loginRetryAfter returns how long the caller must wait before another
+// login attempt for email from ip is allowed, or zero.
+func (cfg *apiConfig) loginRetryAfter(ctx context.Context, email, ip string) (time.Duration, error) {
+	var wait time.Duration
+	now := time.Now().UTC()
+
+	for _, p := range []database.GetLoginFailureParams{
+		{Kind: loginKindAccount, Subject: normalizeEmail(email)},
+		{Kind: loginKindIP, Subject: ip},
+	} {
+		f, err := cfg.dbQueries.GetLoginFailure(ctx, p)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if d := loginBlockedUntil(f).Sub(now); d > wait {
+			wait = d
+		}
+	}
+
+	return wait, nil
+}
+
+func (cfg *apiConfig) recordLoginFailure(ctx context.Context, email, ip string) {
+	for _, p := range []database.RecordLoginFailureParams{
+		{Kind: loginKindAccount, Subject: normalizeEmail(email)},
+		{Kind: loginKindIP, Subject: ip},
+	} {
+		f, err := cfg.dbQueries.RecordLoginFailure(ctx, p)
+		if err != nil {
+			log.Printf("Error recording login failure %s", err)
+			continue
+		}
+		if f.Kind == loginKindIP || f.Failures < loginLockoutAfter {
+			continue
+		}
+
+		lockedUntil := sql.NullTime{Time: f.LastFailureAt.Add(loginDelay(f.Failures)), Valid: true}
+		err = cfg.dbQueries.LockLoginSubject(ctx, database.LockLoginSubjectParams{Kind: f.Kind, Subject: f.Subject, LockedUntil: lockedUntil})
+		if err != nil {
+			log.Printf("Error locking %s %s: %s", f.Kind, f.Subject, err)
+			continue
+		}
+		err = cfg.dbQueries.CreateLockoutEvent(ctx, database.CreateLockoutEventParams{
+			Kind:        f.Kind,
+			Subject:     f.Subject,
+			Event:       "locked",
+			Failures:    f.Failures,
+			LockedUntil: lockedUntil,
+		})
+		if err != nil {
+			log.Printf("Error recording lockout event %s", err)
+		}
+		log.Printf("Locked out %s %s after %d failed logins", f.Kind, f.Subject, f.Failures)
+	}
+}
+
+func (cfg *apiConfig) clearLoginFailures(ctx context.Context, email string) {
+	_, err := cfg.dbQueries.ClearLoginFailures(ctx, database.ClearLoginFailuresParams{Kind: loginKindAccount, Subject: normalizeEmail(email)})
+	if err != nil {
+		log.Printf("Error clearing login failures %s", err)
+	}
+}
+
+func (cfg *apiConfig) unlockAccount(w http.ResponseWriter, req *http.Request) {
+	type unlockRequest struct {
+		Email string `json:"email"`
+		IP    string `json:"ip"`
+	}
+
+	var ur unlockRequest
+	decoder := json.NewDecoder(req.Body)
+	err := decoder.Decode(&ur)
+	if err != nil || (ur.Email == "" && ur.IP == "") {
+		log.Printf("Error decoding json parameters: %v", err)
+		w.WriteHeader(400)
+		js, _ := json.Marshal(jsonError{Error: "email or ip is required"})
+		w.Write(js)
+		return
+	}
+
+	var actorID uuid.NullUUID
+	if id, ok := userIDFromContext(req.Context()); ok {
+		actorID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	var targets []database.ClearLoginFailuresParams
+	if ur.Email != "" {
+		targets = append(targets, database.ClearLoginFailuresParams{Kind: loginKindAccount, Subject: normalizeEmail(ur.Email)})
+	}
+	if ur.IP != "" {
+		targets = append(targets, database.ClearLoginFailuresParams{Kind: loginKindIP, Subject: ur.IP})
+	}
+
+	var cleared int64
+	for _, t := range targets {
+		n, err := cfg.dbQueries.ClearLoginFailures(req.Context(), t)
+		if err != nil {
+			log.Printf("Error clearing login failures %s", err)
+			w.WriteHeader(500)
+			js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+			w.Write(js)
+			return
+		}
+		if n == 0 {
+			continue
+		}
+		cleared += n
+
+		err = cfg.dbQueries.CreateLockoutEvent(req.Context(), database.CreateLockoutEventParams{
+			Kind:    t.Kind,
+			Subject: t.Subject,
+			Event:   "unlocked",
+			ActorID: actorID,
+		})
+		if err != nil {
+			log.Printf("Error recording lockout event %s", err)
+		}
+	}
+
+	if cleared == 0 {
+		w.WriteHeader(404)
+		js, _ := json.Marshal(jsonError{Error: "No failed logins recorded"})
+		w.Write(js)
+		return
+	}
+
+	w.WriteHeader(204)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"database/sql"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/deoreal/chirpy/internal/database"
+)
+
+func TestLoginDelay(t *testing.T) {
+	tests := []struct {
+		failures int32
+		want     time.Duration
+	}{
+		{failures: 0, want: 0},
+		{failures: 2, want: 0},
+		{failures: 3, want: time.Second},
+		{failures: 4, want: 2 * time.Second},
+		{failures: 9, want: 64 * time.Second},
+		{failures: 10, want: loginLockoutDuration},
+		{failures: 11, want: 2 * loginLockoutDuration},
+		{failures: 1000, want: loginMaxLockout},
+	}
+
+	for _, tt := range tests {
+		if got := loginDelay(tt.failures); got != tt.want {
+			t.Errorf("loginDelay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginBlockedUntil(t *testing.T) {
+	last := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	f := database.LoginFailure{Failures: 4, LastFailureAt: last}
+	if got, want := loginBlockedUntil(f), last.Add(2*time.Second); !got.Equal(want) {
+		t.Errorf("loginBlockedUntil() = %v, want %v", got, want)
+	}
+
+	// An explicit lock later than the backoff wins.
+	f.LockedUntil = sql.NullTime{Time: last.Add(time.Hour), Valid: true}
+	if got, want := loginBlockedUntil(f), last.Add(time.Hour); !got.Equal(want) {
+		t.Errorf("loginBlockedUntil() = %v, want %v", got, want)
+	}
+}
+
+func TestLoginBlockedUntilIPOnlyBacksOff(t *testing.T) {
+	last := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// However many failures an IP has, and even if it was locked before,
+	// it never waits longer than loginIPMaxDelay.
+	f := database.LoginFailure{
+		Kind:          loginKindIP,
+		Failures:      1000,
+		LastFailureAt: last,
+		LockedUntil:   sql.NullTime{Time: last.Add(time.Hour), Valid: true},
+	}
+	if got, want := loginBlockedUntil(f), last.Add(loginIPMaxDelay); !got.Equal(want) {
+		t.Errorf("loginBlockedUntil() = %v, want %v", got, want)
+	}
+
+	f.Failures = 4
+	if got, want := loginBlockedUntil(f), last.Add(2*time.Second); !got.Equal(want) {
+		t.Errorf("loginBlockedUntil() = %v, want %v", got, want)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := parseTrustedProxies("10.0.0.0/8, 192.0.2.1")
+	if err != nil {
+		t.Fatalf("parseTrustedProxies() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{name: "untrusted peer", remoteAddr: "203.0.113.7:54321", forwarded: []string{"198.51.100.1"}, want: "203.0.113.7"},
+		{name: "trusted proxy", remoteAddr: "10.1.2.3:443", forwarded: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		{name: "proxy chain", remoteAddr: "10.1.2.3:443", forwarded: []string{"1.2.3.4, 198.51.100.1, 192.0.2.1"}, want: "198.51.100.1"},
+		{name: "split headers", remoteAddr: "192.0.2.1:443", forwarded: []string{"1.2.3.4", "198.51.100.1"}, want: "198.51.100.1"},
+		{name: "no header", remoteAddr: "10.1.2.3:443", want: "10.1.2.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/login", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, h := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", h)
+			}
+			if got := clientIP(req, trusted); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseTrustedProxies("10.0.0.0/99"); err == nil {
+		t.Error("parseTrustedProxies() expected error but got none")
+	}
+}
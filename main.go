@@ -1,30 +1,68 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/deoreal/chirpy/internal/auth"
 	"github.com/deoreal/chirpy/internal/database"
+	"github.com/deoreal/chirpy/internal/mailer"
+	"github.com/deoreal/chirpy/internal/oidc"
+	"github.com/deoreal/chirpy/internal/timeline"
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 var tokenSecret string
 
+const (
+	accessTokenExpiry  = time.Hour
+	refreshTokenExpiry = 60 * 24 * time.Hour
+)
+
 type apiConfig struct {
 	fileserverHits atomic.Int32
 	dbQueries      *database.Queries
 	db             *sql.DB
-	TokenSecret    string
+	JWTKeys        *auth.Keyring
+	PolkaKey       string
+	PasswordPolicy auth.PasswordPolicy
+	Mailer         mailer.Mailer
+	BaseURL        string
+	// RequireVerifiedEmail stops users posting chirps or rechirps until
+	// they have confirmed their email address.
+	RequireVerifiedEmail bool
+	// Platform is "dev" on development and integration environments;
+	// destructive admin endpoints refuse to run anywhere else.
+	Platform string
+	// Fixtures, if set, are seeded after every POST /admin/reset.
+	Fixtures *fixtures
+	// OIDC is the single sign-on provider, or nil if SSO is disabled.
+	OIDC *oidc.Client
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For header
+	// identifies the client for login throttling.
+	TrustedProxies []netip.Prefix
+	// Timelines caches home timelines, or is nil to always read them
+	// from the database. Chirps by authors with more than FanoutLimit
+	// followers are not pushed into it.
+	Timelines   *timeline.Cache
+	FanoutLimit int
 }
 type Chirp struct {
 	ID        uuid.UUID `json:"id"`
@@ -32,10 +70,147 @@ type Chirp struct {
 	UpdatedAt time.Time `json:"updated_at"`
 	Body      string    `json:"body"`
 	UserID    uuid.UUID `json:"user_id"`
+	// ReplyToID is the chirp this one answers, if any.
+	ReplyToID  *uuid.UUID `json:"reply_to_id,omitempty"`
+	ReplyCount int64      `json:"reply_count"`
+	LikeCount  int64      `json:"like_count"`
+	// LikedByMe is only ever true for requests made with a valid token.
+	LikedByMe bool `json:"liked_by_me"`
+	// A rechirp has an empty body and shares RechirpOfID; a quote chirp
+	// has its own body and quotes QuoteOfID. Either way the shared chirp
+	// is embedded as Original while it still exists.
+	RechirpOfID *uuid.UUID `json:"rechirp_of_id,omitempty"`
+	QuoteOfID   *uuid.UUID `json:"quote_of_id,omitempty"`
+	Original    *Chirp     `json:"original,omitempty"`
+}
+
+func chirpFromDB(c database.Chirpmsg) Chirp {
+	chirp := Chirp{ID: c.ID, CreatedAt: c.CreatedAt, UpdatedAt: c.UpdatedAt, Body: c.Body, UserID: c.UserID}
+	if c.ReplyToID.Valid {
+		chirp.ReplyToID = &c.ReplyToID.UUID
+	}
+	if c.RechirpOfID.Valid {
+		chirp.RechirpOfID = &c.RechirpOfID.UUID
+	}
+	if c.QuoteOfID.Valid {
+		chirp.QuoteOfID = &c.QuoteOfID.UUID
+	}
+	return chirp
+}
+
+// originalID returns the chirp that c rechirps or quotes, if any.
+func (c Chirp) originalID() (uuid.UUID, bool) {
+	switch {
+	case c.RechirpOfID != nil:
+		return *c.RechirpOfID, true
+	case c.QuoteOfID != nil:
+		return *c.QuoteOfID, true
+	}
+	return uuid.UUID{}, false
+}
+
+// annotateChirps embeds the chirps that rechirps and quotes refer to, fills
+// in the counts that are not stored on the chirp itself, and records
+// whether the caller in ctx, if any, liked each one. It costs the same few
+// queries however many chirps there are.
+func (cfg *apiConfig) annotateChirps(ctx context.Context, chirps []Chirp) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+
+	var originalIDs []uuid.UUID
+	for _, c := range chirps {
+		if id, ok := c.originalID(); ok {
+			originalIDs = append(originalIDs, id)
+		}
+	}
+	var originals []Chirp
+	if len(originalIDs) > 0 {
+		dbOriginals, err := cfg.dbQueries.GetChirpsByIDs(ctx, originalIDs)
+		if err != nil {
+			return err
+		}
+		for _, o := range dbOriginals {
+			originals = append(originals, chirpFromDB(o))
+		}
+	}
+
+	// Count for the chirps and their originals together, then copy the
+	// results back.
+	all := make([]Chirp, 0, len(chirps)+len(originals))
+	all = append(append(all, chirps...), originals...)
+	if err := cfg.countEngagement(ctx, all); err != nil {
+		return err
+	}
+	copy(chirps, all)
+	originals = all[len(chirps):]
+
+	byID := make(map[uuid.UUID]Chirp, len(originals))
+	for _, o := range originals {
+		byID[o.ID] = o
+	}
+	for i := range chirps {
+		id, ok := chirps[i].originalID()
+		if !ok {
+			continue
+		}
+		if o, ok := byID[id]; ok {
+			chirps[i].Original = &o
+		}
+	}
+
+	return nil
+}
+
+// countEngagement sets the reply and like counts and LikedByMe on chirps.
+func (cfg *apiConfig) countEngagement(ctx context.Context, chirps []Chirp) error {
+	ids := make([]uuid.UUID, 0, len(chirps))
+	for _, c := range chirps {
+		ids = append(ids, c.ID)
+	}
+
+	replyCounts, err := cfg.dbQueries.CountReplies(ctx, ids)
+	if err != nil {
+		return err
+	}
+	replies := make(map[uuid.UUID]int64, len(replyCounts))
+	for _, c := range replyCounts {
+		replies[c.ReplyToID.UUID] = c.Replies
+	}
+
+	likeCounts, err := cfg.dbQueries.CountLikes(ctx, ids)
+	if err != nil {
+		return err
+	}
+	likes := make(map[uuid.UUID]int64, len(likeCounts))
+	for _, c := range likeCounts {
+		likes[c.ChirpID] = c.Likes
+	}
+
+	liked := map[uuid.UUID]bool{}
+	if viewerID, ok := userIDFromContext(ctx); ok {
+		likedIDs, err := cfg.dbQueries.ListLikedChirpIDs(ctx, database.ListLikedChirpIDsParams{UserID: viewerID, ChirpIds: ids})
+		if err != nil {
+			return err
+		}
+		for _, id := range likedIDs {
+			liked[id] = true
+		}
+	}
+
+	for i := range chirps {
+		chirps[i].ReplyCount = replies[chirps[i].ID]
+		chirps[i].LikeCount = likes[chirps[i].ID]
+		chirps[i].LikedByMe = liked[chirps[i].ID]
+	}
+
+	return nil
 }
 
 type ChirpyMessage struct {
-	Body string `json:"body"`
+	Body      string     `json:"body"`
+	ReplyToID *uuid.UUID `json:"reply_to_id"`
+	QuoteOfID *uuid.UUID `json:"quote_of_id"`
 }
 
 type Chirpy struct {
@@ -66,6 +241,10 @@ type User struct {
 	Email          string    `json:"email"`
 	HashedPassword string    `json:"hashed_password"`
 	Token          string    `json:"token"`
+	RefreshToken   string    `json:"refresh_token"`
+	IsChirpyRed    bool      `json:"is_chirpy_red"`
+	EmailVerified  bool      `json:"email_verified"`
+	Role           string    `json:"role"`
 }
 
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
@@ -77,6 +256,20 @@ func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 	})
 }
 
+type contextKey string
+
+const (
+	userIDKey    contextKey = "userID"
+	roleKey      contextKey = "role"
+	sessionIDKey contextKey = "sessionID"
+)
+
+// userIDFromContext returns the authenticated user ID stored by middlewareTokenAuth.
+func userIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	userID, ok := ctx.Value(userIDKey).(uuid.UUID)
+	return userID, ok
+}
+
 func (cfg *apiConfig) middlewareTokenAuth(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		token, err := auth.GetBearerToken(r.Header)
@@ -85,20 +278,76 @@ func (cfg *apiConfig) middlewareTokenAuth(next http.HandlerFunc) http.HandlerFun
 			w.WriteHeader(401)
 			js, _ := json.Marshal(jsonError{Error: "Unauthorized"})
 			w.Write(js)
+			return
 		}
 
-		_, err = auth.ValidateJWT(token, cfg.TokenSecret)
+		ctx, err := cfg.authenticateToken(r.Context(), token)
 		if err != nil {
 			log.Printf("Invalid Token  %s", err)
 			w.WriteHeader(401)
 			js, _ := json.Marshal(jsonError{Error: "Unauthorized"})
 			w.Write(js)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// middlewareOptionalAuth identifies the caller of a public endpoint when
+// the request carries a valid bearer token. Requests without one, or with
+// one that does not validate, are served anonymously. API keys are held to
+// scope like they are by middlewareScopedAuth.
+func (cfg *apiConfig) middlewareOptionalAuth(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key, err := auth.GetAPIKey(r.Header); err == nil {
+			ctx, ok := cfg.authenticateAPIKey(w, r, key, scope)
+			if !ok {
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
 		}
 
-		next.ServeHTTP(w, r)
+		ctx, err := cfg.authenticateToken(r.Context(), token)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// authenticateToken validates an access token and returns ctx carrying the
+// caller's user ID, role and session.
+func (cfg *apiConfig) authenticateToken(ctx context.Context, token string) (context.Context, error) {
+	claims, err := cfg.JWTKeys.ValidateJWTClaims(token)
+	if err != nil {
+		return nil, err
+	}
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, userIDKey, userID)
+	ctx = context.WithValue(ctx, roleKey, claims.Role)
+	if claims.SessionID != "" {
+		sessionID, err := cfg.checkSession(ctx, claims.SessionID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid session: %s", err)
+		}
+		ctx = context.WithValue(ctx, sessionIDKey, sessionID)
+	}
+
+	return ctx, nil
+}
+
 func healthz(w http.ResponseWriter, req *http.Request) {
 	str := "OK"
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
@@ -115,25 +364,6 @@ func (cfg *apiConfig) metrics(w http.ResponseWriter, req *http.Request) {
 	w.Write([]byte(resp))
 }
 
-func (cfg *apiConfig) reset(w http.ResponseWriter, req *http.Request) {
-	sqlStatement := fmt.Sprintf("TRUNCATE TABLE %s", "chirpmsgs,users")
-	//	cfg.fileserverHits.Store(0)
-	//	resp := fmt.Sprintf("Hits: %d", cfg.fileserverHits.Load())
-	//	w.Write([]byte(resp))
-
-	// db.Exec executes the SQL statement without returning any rows.
-	cfg.db.Exec(sqlStatement)
-	/*	if err != nil {
-			log.Printf("Error decoding json parameters: %s", err)
-			w.WriteHeader(500)
-			js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
-			w.Write(js)
-		}
-	*/
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-}
-
 func assets(w http.ResponseWriter, req *http.Request) {
 	str := `
 <pre>
@@ -176,38 +406,189 @@ func (cfg *apiConfig) userAdd(w http.ResponseWriter, req *http.Request) {
 	err := decoder.Decode(&uc)
 	if err != nil {
 		log.Printf("Error decoding email address %s", err)
+		w.WriteHeader(400)
+		js, _ := json.Marshal(jsonError{Error: "Invalid request body"})
+		w.Write(js)
+		return
+	}
+	if !cfg.checkPasswordPolicy(w, uc.Password) {
+		return
+	}
+	pw, err := auth.HashPassword(uc.Password)
+	if err != nil {
+		log.Printf("Error hashing password %s", err)
 		w.WriteHeader(500)
 		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
 		w.Write(js)
+		return
+	}
+	user, err := cfg.dbQueries.CreateUser(req.Context(), database.CreateUserParams{Email: uc.Email, HashedPassword: pw})
+	if err != nil {
+		if isUniqueViolation(err) {
+			w.WriteHeader(409)
+			js, _ := json.Marshal(jsonError{Error: "Email already in use"})
+			w.Write(js)
+			return
+		}
+		log.Printf("Error creating user %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+	if err := cfg.sendVerificationEmail(req.Context(), user); err != nil {
+		log.Printf("Error sending verification email %s", err)
+	}
+	usr := User{ID: user.ID, CreatedAt: user.CreatedAt, UpdatedAt: user.UpdatedAt, Email: user.Email, HashedPassword: "***", IsChirpyRed: user.IsChirpyRed, EmailVerified: user.EmailVerifiedAt.Valid, Role: user.Role}
+
+	w.Header().Set("Content-Type", "text/json; charset=utf-8")
+	w.WriteHeader(201)
+
+	js, _ := json.Marshal(usr)
+	w.Write(js)
+}
+
+// checkPasswordPolicy writes a 422 naming the failed rules and returns
+// false when password does not satisfy the configured policy.
+func (cfg *apiConfig) checkPasswordPolicy(w http.ResponseWriter, password string) bool {
+	type policyError struct {
+		Error       string   `json:"error"`
+		FailedRules []string `json:"failed_rules"`
+	}
+
+	var pe *auth.PolicyError
+	if err := cfg.PasswordPolicy.Check(password); errors.As(err, &pe) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(422)
+		js, _ := json.Marshal(policyError{Error: "Password does not meet policy", FailedRules: pe.Failed})
+		w.Write(js)
+		return false
+	}
+
+	return true
+}
+
+func (cfg *apiConfig) userUpdate(w http.ResponseWriter, req *http.Request) {
+	type userCredentials struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	userID, _ := userIDFromContext(req.Context())
+
+	var uc userCredentials
+	decoder := json.NewDecoder(req.Body)
+	err := decoder.Decode(&uc)
+	if err != nil || uc.Email == "" || uc.Password == "" {
+		log.Printf("Error decoding json parameters: %v", err)
+		w.WriteHeader(400)
+		js, _ := json.Marshal(jsonError{Error: "Invalid request body"})
+		w.Write(js)
+		return
+	}
+	if !cfg.checkPasswordPolicy(w, uc.Password) {
+		return
 	}
+
 	pw, err := auth.HashPassword(uc.Password)
 	if err != nil {
 		log.Printf("Error hashing password %s", err)
 		w.WriteHeader(500)
 		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
 		w.Write(js)
+		return
+	}
 
+	user, err := cfg.dbQueries.UpdateUser(req.Context(), database.UpdateUserParams{ID: userID, Email: uc.Email, HashedPassword: pw})
+	if err != nil {
+		if isUniqueViolation(err) {
+			log.Printf("Email already in use %s", err)
+			w.WriteHeader(409)
+			js, _ := json.Marshal(jsonError{Error: "Email already in use"})
+			w.Write(js)
+			return
+		}
+		log.Printf("Error updating user %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
 	}
-	user, _ := cfg.dbQueries.CreateUser(req.Context(), database.CreateUserParams{Email: uc.Email, HashedPassword: pw})
-	fmt.Println("user", user)
-	usr := User{ID: user.ID, CreatedAt: user.CreatedAt, UpdatedAt: user.UpdatedAt, Email: user.Email, HashedPassword: "***"}
+	// Changing the email address clears its verification; mail the new
+	// address straight away rather than waiting for a resend request.
+	if !user.EmailVerifiedAt.Valid {
+		if err := cfg.sendVerificationEmail(req.Context(), user); err != nil {
+			log.Printf("Error sending verification email %s", err)
+		}
+	}
+	usr := User{ID: user.ID, CreatedAt: user.CreatedAt, UpdatedAt: user.UpdatedAt, Email: user.Email, HashedPassword: "***", IsChirpyRed: user.IsChirpyRed, EmailVerified: user.EmailVerifiedAt.Valid, Role: user.Role}
 
-	w.Header().Set("Content-Type", "text/json; charset=utf-8")
-	w.WriteHeader(201)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	js, _ := json.Marshal(usr)
+	w.Write(js)
+}
+
+func (cfg *apiConfig) getCurrentUser(w http.ResponseWriter, req *http.Request) {
+	userID, _ := userIDFromContext(req.Context())
 
+	user, err := cfg.dbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(404)
+			js, _ := json.Marshal(jsonError{Error: "User not found"})
+			w.Write(js)
+			return
+		}
+		log.Printf("Error db query %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+	usr := User{ID: user.ID, CreatedAt: user.CreatedAt, UpdatedAt: user.UpdatedAt, Email: user.Email, HashedPassword: "***", IsChirpyRed: user.IsChirpyRed, EmailVerified: user.EmailVerifiedAt.Valid, Role: user.Role}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
 	js, _ := json.Marshal(usr)
 	w.Write(js)
 }
 
+// isUniqueViolation reports whether err is a postgres unique_violation.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// isForeignKeyViolation reports whether err is a postgres
+// foreign_key_violation, i.e. a referenced row does not exist.
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
+
+// foreignKeyConstraint returns the name of the foreign key constraint err
+// violated, if it is a postgres foreign_key_violation.
+func foreignKeyConstraint(err error) (string, bool) {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+		return pqErr.Constraint, true
+	}
+	return "", false
+}
+
 func (cfg *apiConfig) addChirp(w http.ResponseWriter, req *http.Request) {
-	c := Chirp{}
+	userID, _ := userIDFromContext(req.Context())
+
+	c := ChirpyMessage{}
 	decoder := json.NewDecoder(req.Body)
 	err := decoder.Decode(&c)
 	if err != nil {
 		log.Printf("Error decoding json parameters: %s", err)
-		w.WriteHeader(500)
-		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.WriteHeader(400)
+		js, _ := json.Marshal(jsonError{Error: "Invalid request body"})
 		w.Write(js)
+		return
 	}
 
 	if len(c.Body) > 140 {
@@ -218,10 +599,71 @@ func (cfg *apiConfig) addChirp(w http.ResponseWriter, req *http.Request) {
 		return
 
 	}
-	d := database.CreateChirpParams{Body: c.Body, UserID: c.UserID}
-	fmt.Println("d", d)
-	chr, _ := cfg.dbQueries.CreateChirp(req.Context(), d)
-	chirp := Chirp{ID: chr.ID, CreatedAt: chr.CreatedAt, UpdatedAt: chr.UpdatedAt, Body: chr.Body, UserID: chr.UserID}
+	if !cfg.requireVerifiedEmail(w, req, userID) {
+		return
+	}
+
+	d := database.CreateChirpParams{Body: c.Body, UserID: userID}
+	if c.ReplyToID != nil {
+		d.ReplyToID = uuid.NullUUID{UUID: *c.ReplyToID, Valid: true}
+	}
+	if c.QuoteOfID != nil {
+		if c.Body == "" {
+			w.WriteHeader(400)
+			js, _ := json.Marshal(jsonError{Error: "A quote chirp needs a body; rechirp instead"})
+			w.Write(js)
+			return
+		}
+		quoted, err := cfg.dbQueries.GetChirpById(req.Context(), *c.QuoteOfID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				w.WriteHeader(400)
+				js, _ := json.Marshal(jsonError{Error: "Quoted chirp does not exist"})
+				w.Write(js)
+				return
+			}
+			log.Printf("Error db query %s", err)
+			w.WriteHeader(500)
+			js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+			w.Write(js)
+			return
+		}
+		// Quoting a rechirp quotes the chirp that was rechirped.
+		if quoted.RechirpOfID.Valid {
+			quoted.ID = quoted.RechirpOfID.UUID
+		}
+		d.QuoteOfID = uuid.NullUUID{UUID: quoted.ID, Valid: true}
+	}
+	chr, err := cfg.dbQueries.CreateChirp(req.Context(), d)
+	if err != nil {
+		switch constraint, _ := foreignKeyConstraint(err); constraint {
+		case "chirpmsgs_reply_to_id_fkey":
+			w.WriteHeader(400)
+			js, _ := json.Marshal(jsonError{Error: "Chirp being replied to does not exist"})
+			w.Write(js)
+			return
+		case "chirpmsgs_quote_of_id_fkey":
+			// The quoted chirp was deleted after we looked it up.
+			w.WriteHeader(400)
+			js, _ := json.Marshal(jsonError{Error: "Quoted chirp does not exist"})
+			w.Write(js)
+			return
+		}
+		log.Printf("Error creating chirp %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+	cfg.fanOut(chr)
+	chirp := chirpFromDB(chr)
+	if chirp.QuoteOfID != nil {
+		chirps := []Chirp{chirp}
+		if err := cfg.annotateChirps(req.Context(), chirps); err != nil {
+			log.Printf("Error db query %s", err)
+		}
+		chirp = chirps[0]
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(201)
@@ -230,30 +672,161 @@ func (cfg *apiConfig) addChirp(w http.ResponseWriter, req *http.Request) {
 }
 
 func (cfg *apiConfig) getChirps(w http.ResponseWriter, req *http.Request) {
-	fmt.Println("entering getChirps")
-	dbChirps, err := cfg.dbQueries.GetChirps(req.Context())
+	type chirpPage struct {
+		Chirps     []Chirp `json:"chirps"`
+		NextCursor string  `json:"next_cursor,omitempty"`
+	}
+
+	p, err := parseChirpListParams(req.URL.Query())
+	if err != nil {
+		log.Printf("Invalid query parameters %s", err)
+		w.WriteHeader(400)
+		js, _ := json.Marshal(jsonError{Error: err.Error()})
+		w.Write(js)
+		return
+	}
+
+	// Fetch one extra row to learn whether another page follows.
+	args := database.ListChirpsParams{AuthorID: p.AuthorID, RowLimit: p.Limit + 1}
+	if p.Cursor != nil {
+		args.CursorCreatedAt = sql.NullTime{Time: p.Cursor.CreatedAt, Valid: true}
+		args.CursorID = uuid.NullUUID{UUID: p.Cursor.ID, Valid: true}
+	}
+
+	var dbChirps []database.Chirpmsg
+	if p.Desc {
+		dbChirps, err = cfg.dbQueries.ListChirpsDesc(req.Context(), database.ListChirpsDescParams(args))
+	} else {
+		dbChirps, err = cfg.dbQueries.ListChirps(req.Context(), args)
+	}
 	if err != nil {
 		log.Printf("Error db query %s", err)
 		w.WriteHeader(500)
 		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
 		w.Write(js)
+		return
+	}
+
+	page := chirpPage{Chirps: []Chirp{}}
+	if len(dbChirps) > int(p.Limit) {
+		dbChirps = dbChirps[:p.Limit]
+		last := dbChirps[len(dbChirps)-1]
+		page.NextCursor = chirpCursor{CreatedAt: last.CreatedAt, ID: last.ID}.encode()
 	}
-	var chirps []Chirp
 	for _, dbChirp := range dbChirps {
-		chirps = append(chirps, Chirp{
-			ID:        dbChirp.ID,
-			CreatedAt: dbChirp.CreatedAt,
-			UpdatedAt: dbChirp.UpdatedAt,
-			Body:      dbChirp.Body,
-			UserID:    dbChirp.UserID,
-		})
-	}
-	fmt.Println(chirps)
+		page.Chirps = append(page.Chirps, chirpFromDB(dbChirp))
+	}
+	if err := cfg.annotateChirps(req.Context(), page.Chirps); err != nil {
+		log.Printf("Error db query %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(200)
-	js, _ := json.Marshal(chirps)
+	js, _ := json.Marshal(page)
 	w.Write(js)
 }
 
+const (
+	defaultChirpLimit = 20
+	maxChirpLimit     = 100
+)
+
+// chirpCursor is the keyset position (created_at, id) of the last row on a
+// page.
+type chirpCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+func (c chirpCursor) encode() string {
+	raw := c.CreatedAt.Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeChirpCursor(s string) (chirpCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return chirpCursor{}, err
+	}
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return chirpCursor{}, fmt.Errorf("malformed cursor")
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return chirpCursor{}, err
+	}
+	chirpID, err := uuid.Parse(id)
+	if err != nil {
+		return chirpCursor{}, err
+	}
+
+	return chirpCursor{CreatedAt: createdAt, ID: chirpID}, nil
+}
+
+type chirpListParams struct {
+	AuthorID uuid.NullUUID
+	Desc     bool
+	Limit    int32
+	Cursor   *chirpCursor
+}
+
+// parseChirpListParams validates the author_id, sort, limit and cursor query
+// parameters of GET /api/chirps. sort defaults to ascending by creation time.
+func parseChirpListParams(q url.Values) (chirpListParams, error) {
+	var p chirpListParams
+	if s := q.Get("author_id"); s != "" {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return chirpListParams{}, fmt.Errorf("invalid author_id")
+		}
+		p.AuthorID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	switch q.Get("sort") {
+	case "", "asc":
+	case "desc":
+		p.Desc = true
+	default:
+		return chirpListParams{}, fmt.Errorf("sort must be asc or desc")
+	}
+
+	var err error
+	p.Limit, p.Cursor, err = parsePageParams(q)
+	if err != nil {
+		return chirpListParams{}, err
+	}
+
+	return p, nil
+}
+
+// parsePageParams validates the limit and cursor query parameters shared
+// by every keyset-paginated listing.
+func parsePageParams(q url.Values) (int32, *chirpCursor, error) {
+	limit := int32(defaultChirpLimit)
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxChirpLimit {
+			return 0, nil, fmt.Errorf("limit must be between 1 and %d", maxChirpLimit)
+		}
+		limit = int32(n)
+	}
+
+	var cursor *chirpCursor
+	if s := q.Get("cursor"); s != "" {
+		c, err := decodeChirpCursor(s)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid cursor")
+		}
+		cursor = &c
+	}
+
+	return limit, cursor, nil
+}
+
 func (cfg *apiConfig) login(w http.ResponseWriter, req *http.Request) {
 	type userCredentials struct {
 		Email      string `json:"email"`
@@ -275,10 +848,29 @@ func (cfg *apiConfig) login(w http.ResponseWriter, req *http.Request) {
 	if uc.Expiration == 0 || uc.Expiration >= 3600 {
 		uc.Expiration = 3600
 	}
+
+	ip := clientIP(req, cfg.TrustedProxies)
+	wait, err := cfg.loginRetryAfter(req.Context(), uc.Email, ip)
+	if err != nil {
+		log.Printf("Error checking login failures: %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		w.WriteHeader(429)
+		js, _ := json.Marshal(jsonError{Error: "Too many failed login attempts"})
+		w.Write(js)
+		return
+	}
+
 	// Get user from database by email
 	user, err := cfg.dbQueries.GetUser(req.Context(), uc.Email)
 	if err != nil {
 		log.Printf("Error getting user: %s", err)
+		cfg.recordLoginFailure(req.Context(), uc.Email, ip)
 		w.WriteHeader(401)
 		js, _ := json.Marshal(jsonError{Error: "Incorrect email or password"})
 		w.Write(js)
@@ -289,13 +881,60 @@ func (cfg *apiConfig) login(w http.ResponseWriter, req *http.Request) {
 	err = auth.CheckPasswordHash(uc.Password, user.HashedPassword)
 	if err != nil {
 		log.Printf("Password validation failed: %s", err)
+		cfg.recordLoginFailure(req.Context(), uc.Email, ip)
 		w.WriteHeader(401)
 		js, _ := json.Marshal(jsonError{Error: "Incorrect email or password"})
 		w.Write(js)
 		return
 	}
 
-	tk, err := auth.MakeJWT(user.ID, cfg.TokenSecret, time.Duration(uc.Expiration))
+	// Upgrade hashes from older algorithms or parameters while we have the
+	// plaintext. A failure here must not block the login.
+	if auth.NeedsRehash(user.HashedPassword) {
+		pw, err := auth.HashPassword(uc.Password)
+		if err == nil {
+			err = cfg.dbQueries.UpdateUserPassword(req.Context(), database.UpdateUserPasswordParams{ID: user.ID, HashedPassword: pw})
+		}
+		if err != nil {
+			log.Printf("Error rehashing password %s", err)
+		}
+	}
+
+	twoFactor, err := cfg.twoFactorEnabled(req.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error loading two-factor settings %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+	if twoFactor {
+		cfg.writeTwoFactorChallenge(w, user.ID)
+		return
+	}
+
+	cfg.clearLoginFailures(req.Context(), uc.Email)
+	cfg.issueLoginTokens(w, req, user, time.Duration(uc.Expiration)*time.Second)
+}
+
+// issueLoginTokens completes a login: it creates an access token and a
+// stored refresh token for user and writes them with the user's details.
+func (cfg *apiConfig) issueLoginTokens(w http.ResponseWriter, req *http.Request, user database.User, expiresIn time.Duration) {
+	session, err := cfg.dbQueries.CreateSession(req.Context(), database.CreateSessionParams{
+		UserID:    user.ID,
+		UserAgent: req.UserAgent(),
+		Ip:        clientIP(req, cfg.TrustedProxies),
+		ExpiresAt: time.Now().UTC().Add(refreshTokenExpiry),
+	})
+	if err != nil {
+		log.Printf("Error creating session %s:", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	tk, err := cfg.JWTKeys.MakeSessionJWT(user.ID, user.Role, session.ID, expiresIn)
 	if err != nil {
 		log.Printf("Error creating token %s:", err)
 		w.WriteHeader(400)
@@ -304,13 +943,40 @@ func (cfg *apiConfig) login(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	rt, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error creating refresh token %s:", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	_, err = cfg.dbQueries.CreateRefreshToken(req.Context(), database.CreateRefreshTokenParams{
+		Token:     rt,
+		UserID:    user.ID,
+		ExpiresAt: session.ExpiresAt,
+		SessionID: uuid.NullUUID{UUID: session.ID, Valid: true},
+	})
+	if err != nil {
+		log.Printf("Error storing refresh token %s:", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
 	// Return user info (without password)
 	usr := User{
-		ID:        user.ID,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-		Email:     user.Email,
-		Token:     tk,
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		Token:         tk,
+		RefreshToken:  rt,
+		IsChirpyRed:   user.IsChirpyRed,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		Role:          user.Role,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -319,6 +985,75 @@ func (cfg *apiConfig) login(w http.ResponseWriter, req *http.Request) {
 	w.Write(js)
 }
 
+func (cfg *apiConfig) refresh(w http.ResponseWriter, req *http.Request) {
+	type tokenResponse struct {
+		Token string `json:"token"`
+	}
+
+	rt, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		log.Printf("No Bearer Token  %s", err)
+		w.WriteHeader(401)
+		js, _ := json.Marshal(jsonError{Error: "Unauthorized"})
+		w.Write(js)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserFromRefreshToken(req.Context(), rt)
+	if err != nil {
+		log.Printf("Invalid refresh token  %s", err)
+		w.WriteHeader(401)
+		js, _ := json.Marshal(jsonError{Error: "Unauthorized"})
+		w.Write(js)
+		return
+	}
+
+	if user.SessionID.Valid {
+		if err := cfg.dbQueries.TouchSession(req.Context(), user.SessionID.UUID); err != nil {
+			log.Printf("Error recording session use %s", err)
+		}
+	}
+
+	tk, err := cfg.JWTKeys.MakeSessionJWT(user.ID, user.Role, user.SessionID.UUID, accessTokenExpiry)
+	if err != nil {
+		log.Printf("Error creating token %s:", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	js, _ := json.Marshal(tokenResponse{Token: tk})
+	w.Write(js)
+}
+
+func (cfg *apiConfig) revoke(w http.ResponseWriter, req *http.Request) {
+	rt, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		log.Printf("No Bearer Token  %s", err)
+		w.WriteHeader(401)
+		js, _ := json.Marshal(jsonError{Error: "Unauthorized"})
+		w.Write(js)
+		return
+	}
+
+	err = cfg.dbQueries.RevokeSessionByRefreshToken(req.Context(), rt)
+	if err == nil {
+		err = cfg.dbQueries.RevokeRefreshToken(req.Context(), rt)
+	}
+	if err != nil {
+		log.Printf("Error revoking refresh token %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
 func (cfg *apiConfig) getChirp(w http.ResponseWriter, req *http.Request) {
 	uuid, _ := uuid.Parse(req.PathValue("chirpID"))
 
@@ -336,9 +1071,244 @@ func (cfg *apiConfig) getChirp(w http.ResponseWriter, req *http.Request) {
 		w.Write([]byte("chirp not found"))
 		return
 	}
-	resp := Chirp{dbChirp.ID, dbChirp.CreatedAt, dbChirp.UpdatedAt, dbChirp.Body, dbChirp.UserID}
+	resp := []Chirp{chirpFromDB(dbChirp)}
+	if err := cfg.annotateChirps(req.Context(), resp); err != nil {
+		log.Printf("Error db query %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+	w.WriteHeader(200)
+	js, _ := json.Marshal(resp[0])
+	w.Write(js)
+}
+
+func (cfg *apiConfig) deleteChirp(w http.ResponseWriter, req *http.Request) {
+	userID, _ := userIDFromContext(req.Context())
+
+	chirpID, err := uuid.Parse(req.PathValue("chirpID"))
+	if err != nil {
+		log.Printf("Invalid chirp id %s", err)
+		w.WriteHeader(404)
+		js, _ := json.Marshal(jsonError{Error: "Chirp not found"})
+		w.Write(js)
+		return
+	}
+
+	dbChirp, err := cfg.dbQueries.GetChirpById(req.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(404)
+			js, _ := json.Marshal(jsonError{Error: "Chirp not found"})
+			w.Write(js)
+			return
+		}
+		log.Printf("Error db query %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	if dbChirp.UserID != userID {
+		w.WriteHeader(403)
+		js, _ := json.Marshal(jsonError{Error: "Forbidden"})
+		w.Write(js)
+		return
+	}
+
+	err = cfg.dbQueries.DeleteChirp(req.Context(), chirpID)
+	if err != nil {
+		log.Printf("Error deleting chirp %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) polkaWebhook(w http.ResponseWriter, req *http.Request) {
+	type webhookEvent struct {
+		Event string `json:"event"`
+		Data  struct {
+			UserID uuid.UUID `json:"user_id"`
+		} `json:"data"`
+	}
+
+	key, err := auth.GetAPIKey(req.Header)
+	if err != nil || subtle.ConstantTimeCompare([]byte(key), []byte(cfg.PolkaKey)) != 1 {
+		log.Printf("Invalid polka api key %v", err)
+		w.WriteHeader(401)
+		js, _ := json.Marshal(jsonError{Error: "Unauthorized"})
+		w.Write(js)
+		return
+	}
+
+	var ev webhookEvent
+	decoder := json.NewDecoder(req.Body)
+	err = decoder.Decode(&ev)
+	if err != nil {
+		log.Printf("Error decoding json parameters: %s", err)
+		w.WriteHeader(400)
+		js, _ := json.Marshal(jsonError{Error: "Invalid request body"})
+		w.Write(js)
+		return
+	}
+
+	if ev.Event != "user.upgraded" {
+		w.WriteHeader(204)
+		return
+	}
+
+	n, err := cfg.dbQueries.UpgradeUserToChirpyRed(req.Context(), ev.Data.UserID)
+	if err != nil {
+		log.Printf("Error upgrading user %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+	if n == 0 {
+		w.WriteHeader(404)
+		js, _ := json.Marshal(jsonError{Error: "User not found"})
+		w.Write(js)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// loadKeyring builds the JWT keyring from configuration. JWT_KEYS is a
+// comma separated list of kid=path PEM keys, with JWT_ACTIVE_KID picking
+// the signing key (default: the first private key). Public keys in
+// JWT_KEYS only verify. Without JWT_KEYS a single JWT_PRIVATE_KEY_FILE or,
+// failing that, the HS256 TOKENSECRET is used.
+//
+// To rotate keys, add the new key and make it active while keeping the
+// old one listed so its tokens still validate; once they have expired,
+// retire the old kid with retireKeys or drop it.
+func loadKeyring(keys, activeKid, keyFile, secret string) (*auth.Keyring, error) {
+	ring := auth.NewKeyring()
+
+	if keys != "" {
+		for _, entry := range strings.Split(keys, ",") {
+			kid, path, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			if !ok {
+				return nil, fmt.Errorf("malformed JWT_KEYS entry %q", entry)
+			}
+			key, err := auth.LoadKey(path)
+			if err != nil {
+				return nil, err
+			}
+			if err := ring.Add(kid, key); err != nil {
+				return nil, err
+			}
+		}
+		if activeKid != "" {
+			if err := ring.SetActive(activeKid); err != nil {
+				return nil, err
+			}
+		}
+		return ring, nil
+	}
+
+	var key *auth.SigningKey
+	var err error
+	if keyFile != "" {
+		key, err = auth.LoadSigningKey(keyFile)
+	} else {
+		key, err = auth.NewHMACKey(secret)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := ring.Add("default", key); err != nil {
+		return nil, err
+	}
+
+	return ring, nil
+}
+
+// retireKeys retires the comma separated kids in JWT_RETIRED_KIDS: tokens
+// they signed stop validating, without the key having to be removed from
+// JWT_KEYS.
+func retireKeys(ring *auth.Keyring, kids string) error {
+	if kids == "" {
+		return nil
+	}
+	for _, kid := range strings.Split(kids, ",") {
+		if err := ring.Retire(strings.TrimSpace(kid)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadPasswordPolicy builds the password policy from PASSWORD_MIN_LENGTH,
+// PASSWORD_MAX_BYTES, PASSWORD_REQUIRE (a comma separated subset of
+// upper,lower,digit,symbol) and PASSWORD_BREACH_LIST, a file of breached
+// passwords one per line.
+func loadPasswordPolicy(getenv func(string) string) (auth.PasswordPolicy, error) {
+	p := auth.DefaultPasswordPolicy
+
+	if s := getenv("PASSWORD_MIN_LENGTH"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return p, fmt.Errorf("invalid PASSWORD_MIN_LENGTH %q", s)
+		}
+		p.MinLength = n
+	}
+	if s := getenv("PASSWORD_MAX_BYTES"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return p, fmt.Errorf("invalid PASSWORD_MAX_BYTES %q", s)
+		}
+		p.MaxBytes = n
+	}
+	if s := getenv("PASSWORD_REQUIRE"); s != "" {
+		for _, class := range strings.Split(s, ",") {
+			switch strings.TrimSpace(class) {
+			case "upper":
+				p.RequireUpper = true
+			case "lower":
+				p.RequireLower = true
+			case "digit":
+				p.RequireDigit = true
+			case "symbol":
+				p.RequireSymbol = true
+			default:
+				return p, fmt.Errorf("unknown PASSWORD_REQUIRE class %q", class)
+			}
+		}
+	}
+	if path := getenv("PASSWORD_BREACH_LIST"); path != "" {
+		breached, err := auth.LoadBreachedPasswords(path)
+		if err != nil {
+			return p, err
+		}
+		p.Breached = breached
+	}
+
+	return p, nil
+}
+
+func (cfg *apiConfig) jwks(w http.ResponseWriter, req *http.Request) {
+	set := cfg.JWTKeys.JWKS()
+	if len(set.Keys) == 0 {
+		w.WriteHeader(404)
+		js, _ := json.Marshal(jsonError{Error: "No public keys"})
+		w.Write(js)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
 	w.WriteHeader(200)
-	js, _ := json.Marshal(resp)
+	js, _ := json.Marshal(set)
 	w.Write(js)
 }
 
@@ -347,9 +1317,7 @@ func main() {
 
 	dbURL := os.Getenv("DBURL")
 	tokenSecret = os.Getenv("TOKENSECRET")
-	fmt.Println("token-secret", tokenSecret)
 
-	fmt.Println("dburl", dbURL)
 	a := new(apiConfig)
 
 	db, err := sql.Open("postgres", dbURL)
@@ -358,19 +1326,89 @@ func main() {
 	}
 	a.db = db
 	a.dbQueries = database.New(db)
-	a.TokenSecret = tokenSecret
+	a.JWTKeys, err = loadKeyring(os.Getenv("JWT_KEYS"), os.Getenv("JWT_ACTIVE_KID"), os.Getenv("JWT_PRIVATE_KEY_FILE"), tokenSecret)
+	if err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %s", err)
+	}
+	if err := retireKeys(a.JWTKeys, os.Getenv("JWT_RETIRED_KIDS")); err != nil {
+		log.Fatalf("Failed to retire JWT signing keys: %s", err)
+	}
+	a.PolkaKey = os.Getenv("POLKA_KEY")
+	a.PasswordPolicy, err = loadPasswordPolicy(os.Getenv)
+	if err != nil {
+		log.Fatalf("Failed to load password policy: %s", err)
+	}
+	a.Mailer = loadMailer(os.Getenv)
+	a.BaseURL = os.Getenv("BASE_URL")
+	if a.BaseURL == "" {
+		a.BaseURL = "http://localhost:8080"
+	}
+	a.RequireVerifiedEmail = os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true"
+	a.OIDC, err = loadOIDC(os.Getenv, a.BaseURL)
+	if err != nil {
+		log.Fatalf("Failed to configure single sign-on: %s", err)
+	}
+	a.TrustedProxies, err = parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatalf("Failed to load trusted proxies: %s", err)
+	}
+	a.Platform = os.Getenv("PLATFORM")
+	if path := os.Getenv("RESET_FIXTURES"); path != "" {
+		a.Fixtures, err = loadFixtures(path)
+		if err != nil {
+			log.Fatalf("Failed to load reset fixtures: %s", err)
+		}
+	}
+	a.Timelines, a.FanoutLimit, err = loadTimelineCache(os.Getenv)
+	if err != nil {
+		log.Fatalf("Failed to configure timeline cache: %s", err)
+	}
 
 	mux := http.NewServeMux()
 	mux.Handle("/app/", a.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir("./")))))
 	mux.HandleFunc("GET /api/healthz", healthz)
+	mux.HandleFunc("GET /.well-known/jwks.json", a.jwks)
 	mux.HandleFunc("GET /app/assets", assets)
-	mux.HandleFunc("GET /admin/metrics", a.metrics)
-	mux.HandleFunc("POST /admin/reset", a.reset)
+	mux.HandleFunc("GET /admin/metrics", a.requireRole(roleAdmin, a.metrics))
+	mux.HandleFunc("POST /admin/reset", a.requireRole(roleAdmin, a.reset))
+	mux.HandleFunc("POST /admin/unlock", a.requireRole(roleAdmin, a.unlockAccount))
+	mux.HandleFunc("PUT /admin/users/{userID}/role", a.requireRole(roleAdmin, a.setUserRole))
 	mux.HandleFunc("POST /api/users", a.userAdd)
+	mux.HandleFunc("PUT /api/users", a.middlewareTokenAuth(a.userUpdate))
+	mux.HandleFunc("GET /api/users/me", a.middlewareScopedAuth(scopeUsersRead, a.getCurrentUser))
+	mux.HandleFunc("PUT /api/users/{userID}/follow", a.middlewareTokenAuth(a.followUser))
+	mux.HandleFunc("DELETE /api/users/{userID}/follow", a.middlewareTokenAuth(a.unfollowUser))
+	mux.HandleFunc("GET /api/users/{userID}/followers", a.listFollowers)
+	mux.HandleFunc("GET /api/users/{userID}/following", a.listFollowing)
+	mux.HandleFunc("POST /api/users/verify", a.verifyEmail)
+	mux.HandleFunc("POST /api/users/verify/resend", a.middlewareTokenAuth(a.resendVerification))
+	mux.HandleFunc("POST /api/password-reset", a.requestPasswordReset)
+	mux.HandleFunc("POST /api/password-reset/confirm", a.confirmPasswordReset)
 	mux.HandleFunc("POST /api/login", a.login)
-	mux.HandleFunc("GET /api/chirps", a.getChirps)
-	mux.HandleFunc("POST /api/chirps", a.middlewareTokenAuth(a.addChirp))
-	mux.HandleFunc("GET /api/chirps/{chirpID}", a.getChirp)
+	mux.HandleFunc("POST /api/login/2fa", a.loginTwoFactor)
+	mux.HandleFunc("GET /api/oidc/login", a.oidcLogin)
+	mux.HandleFunc("GET /api/oidc/callback", a.oidcCallback)
+	mux.HandleFunc("POST /api/2fa/enroll", a.middlewareTokenAuth(a.enrollTOTP))
+	mux.HandleFunc("POST /api/2fa/verify", a.middlewareTokenAuth(a.verifyTOTP))
+	mux.HandleFunc("POST /api/keys", a.middlewareTokenAuth(a.createAPIKey))
+	mux.HandleFunc("GET /api/keys", a.middlewareTokenAuth(a.listAPIKeys))
+	mux.HandleFunc("DELETE /api/keys/{keyID}", a.middlewareTokenAuth(a.revokeAPIKey))
+	mux.HandleFunc("POST /api/refresh", a.refresh)
+	mux.HandleFunc("GET /api/sessions", a.middlewareTokenAuth(a.listSessions))
+	mux.HandleFunc("DELETE /api/sessions", a.middlewareTokenAuth(a.revokeSessions))
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", a.middlewareTokenAuth(a.revokeSession))
+	mux.HandleFunc("POST /api/revoke", a.revoke)
+	mux.HandleFunc("POST /api/polka/webhooks", a.polkaWebhook)
+	mux.HandleFunc("GET /api/chirps", a.middlewareOptionalAuth(scopeChirpsRead, a.getChirps))
+	mux.HandleFunc("GET /api/timeline", a.middlewareScopedAuth(scopeChirpsRead, a.getTimeline))
+	mux.HandleFunc("POST /api/chirps", a.middlewareScopedAuth(scopeChirpsWrite, a.addChirp))
+	mux.HandleFunc("GET /api/chirps/{chirpID}", a.middlewareOptionalAuth(scopeChirpsRead, a.getChirp))
+	mux.HandleFunc("GET /api/chirps/{chirpID}/thread", a.middlewareOptionalAuth(scopeChirpsRead, a.getThread))
+	mux.HandleFunc("PUT /api/chirps/{chirpID}/like", a.middlewareScopedAuth(scopeChirpsWrite, a.likeChirp))
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/like", a.middlewareScopedAuth(scopeChirpsWrite, a.unlikeChirp))
+	mux.HandleFunc("POST /api/chirps/{chirpID}/rechirp", a.middlewareScopedAuth(scopeChirpsWrite, a.rechirp))
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/rechirp", a.middlewareScopedAuth(scopeChirpsWrite, a.undoRechirp))
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}", a.middlewareScopedAuth(scopeChirpsWrite, a.deleteChirp))
 
 	err = http.ListenAndServe("localhost:8080", mux)
 	if err != nil {
@@ -1,11 +1,28 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/deoreal/chirpy/internal/auth"
+	"github.com/deoreal/chirpy/internal/database"
+	"github.com/deoreal/chirpy/internal/dbtest"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 func TestChirpJSONMarshaling(t *testing.T) {
@@ -44,3 +61,423 @@ func TestChirpJSONMarshaling(t *testing.T) {
 		t.Errorf("UserID mismatch: got %v, want %v", unmarshaled.UserID, chirp.UserID)
 	}
 }
+
+func TestIsUniqueViolation(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "unique violation", err: &pq.Error{Code: "23505"}, want: true},
+		{name: "wrapped unique violation", err: fmt.Errorf("update: %w", &pq.Error{Code: "23505"}), want: true},
+		{name: "foreign key violation", err: &pq.Error{Code: "23503"}, want: false},
+		{name: "plain error", err: errors.New("boom"), want: false},
+		{name: "nil error", err: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isUniqueViolation(tt.err); got != tt.want {
+				t.Errorf("isUniqueViolation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForeignKeyConstraint(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		want   string
+		wantOK bool
+	}{
+		{name: "reply", err: &pq.Error{Code: "23503", Constraint: "chirpmsgs_reply_to_id_fkey"}, want: "chirpmsgs_reply_to_id_fkey", wantOK: true},
+		{name: "wrapped quote", err: fmt.Errorf("insert: %w", &pq.Error{Code: "23503", Constraint: "chirpmsgs_quote_of_id_fkey"}), want: "chirpmsgs_quote_of_id_fkey", wantOK: true},
+		{name: "unique violation", err: &pq.Error{Code: "23505", Constraint: "chirpmsgs_body_key"}},
+		{name: "nil error", err: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := foreignKeyConstraint(tt.err)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("foreignKeyConstraint() = %q, %v; want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestUserIDFromContext(t *testing.T) {
+	userID := uuid.New()
+
+	ctx := context.WithValue(context.Background(), userIDKey, userID)
+	got, ok := userIDFromContext(ctx)
+	if !ok {
+		t.Fatal("userIDFromContext() ok = false, want true")
+	}
+	if got != userID {
+		t.Errorf("userIDFromContext() = %v, want %v", got, userID)
+	}
+
+	if _, ok := userIDFromContext(context.Background()); ok {
+		t.Error("userIDFromContext() ok = true on empty context")
+	}
+}
+
+func TestMiddlewareTokenAuthRejects(t *testing.T) {
+	keys, err := loadKeyring("", "", "", "test_secret_key")
+	if err != nil {
+		t.Fatalf("loadKeyring() error = %v", err)
+	}
+	cfg := &apiConfig{JWTKeys: keys}
+
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{name: "missing header", header: ""},
+		{name: "invalid token", header: "Bearer not.a.jwt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			h := cfg.middlewareTokenAuth(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			})
+
+			req := httptest.NewRequest("POST", "/api/chirps", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != 401 {
+				t.Errorf("status = %d, want 401", rec.Code)
+			}
+			if called {
+				t.Error("next handler was called for an unauthenticated request")
+			}
+		})
+	}
+}
+
+func TestParseChirpListParams(t *testing.T) {
+	authorID := uuid.New()
+	cursor := chirpCursor{CreatedAt: time.Date(2025, 1, 2, 3, 4, 5, 123456000, time.UTC), ID: uuid.New()}
+
+	tests := []struct {
+		name    string
+		query   url.Values
+		want    chirpListParams
+		wantErr bool
+	}{
+		{name: "defaults", query: url.Values{}, want: chirpListParams{Limit: defaultChirpLimit}},
+		{name: "sort asc", query: url.Values{"sort": {"asc"}}, want: chirpListParams{Limit: defaultChirpLimit}},
+		{name: "sort desc", query: url.Values{"sort": {"desc"}}, want: chirpListParams{Desc: true, Limit: defaultChirpLimit}},
+		{
+			name:  "author filter",
+			query: url.Values{"author_id": {authorID.String()}, "sort": {"desc"}},
+			want:  chirpListParams{AuthorID: uuid.NullUUID{UUID: authorID, Valid: true}, Desc: true, Limit: defaultChirpLimit},
+		},
+		{name: "limit", query: url.Values{"limit": {"5"}}, want: chirpListParams{Limit: 5}},
+		{
+			name:  "cursor",
+			query: url.Values{"cursor": {cursor.encode()}},
+			want:  chirpListParams{Limit: defaultChirpLimit, Cursor: &cursor},
+		},
+		{name: "invalid author", query: url.Values{"author_id": {"not-a-uuid"}}, wantErr: true},
+		{name: "invalid sort", query: url.Values{"sort": {"sideways"}}, wantErr: true},
+		{name: "zero limit", query: url.Values{"limit": {"0"}}, wantErr: true},
+		{name: "limit too large", query: url.Values{"limit": {"101"}}, wantErr: true},
+		{name: "non-numeric limit", query: url.Values{"limit": {"ten"}}, wantErr: true},
+		{name: "invalid cursor", query: url.Values{"cursor": {"!!!"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseChirpListParams(tt.query)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("parseChirpListParams() expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseChirpListParams() error = %v", err)
+			}
+			if got.AuthorID != tt.want.AuthorID || got.Desc != tt.want.Desc || got.Limit != tt.want.Limit {
+				t.Errorf("parseChirpListParams() = %+v, want %+v", got, tt.want)
+			}
+			if (got.Cursor == nil) != (tt.want.Cursor == nil) {
+				t.Fatalf("Cursor = %v, want %v", got.Cursor, tt.want.Cursor)
+			}
+			if got.Cursor != nil && (!got.Cursor.CreatedAt.Equal(tt.want.Cursor.CreatedAt) || got.Cursor.ID != tt.want.Cursor.ID) {
+				t.Errorf("Cursor = %+v, want %+v", *got.Cursor, *tt.want.Cursor)
+			}
+		})
+	}
+}
+
+func TestPolkaWebhookRejectsBadKey(t *testing.T) {
+	cfg := &apiConfig{PolkaKey: "f271c81ff7084ee5b99a5091b42d486e"}
+
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{name: "missing header", header: ""},
+		{name: "wrong key", header: "ApiKey wrong"},
+		{name: "bearer scheme", header: "Bearer f271c81ff7084ee5b99a5091b42d486e"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/polka/webhooks", strings.NewReader(`{"event":"user.upgraded"}`))
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			cfg.polkaWebhook(rec, req)
+
+			if rec.Code != 401 {
+				t.Errorf("status = %d, want 401", rec.Code)
+			}
+		})
+	}
+}
+
+func TestPolkaWebhookIgnoresUnknownEvents(t *testing.T) {
+	cfg := &apiConfig{PolkaKey: "f271c81ff7084ee5b99a5091b42d486e"}
+
+	req := httptest.NewRequest("POST", "/api/polka/webhooks", strings.NewReader(`{"event":"user.payment_failed","data":{"user_id":"3311741c-680c-4546-99f3-fc9efac2036c"}}`))
+	req.Header.Set("Authorization", "ApiKey f271c81ff7084ee5b99a5091b42d486e")
+	rec := httptest.NewRecorder()
+	cfg.polkaWebhook(rec, req)
+
+	if rec.Code != 204 {
+		t.Errorf("status = %d, want 204", rec.Code)
+	}
+}
+
+func TestMiddlewareTokenAuthSetsUserID(t *testing.T) {
+	keys, err := loadKeyring("", "", "", "test_secret_key")
+	if err != nil {
+		t.Fatalf("loadKeyring() error = %v", err)
+	}
+	cfg := &apiConfig{JWTKeys: keys}
+
+	userID := uuid.New()
+	token, err := keys.MakeJWT(userID, "user", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+
+	var got uuid.UUID
+	h := cfg.middlewareTokenAuth(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = userIDFromContext(r.Context())
+		w.WriteHeader(204)
+	})
+
+	req := httptest.NewRequest("POST", "/api/chirps", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != 204 {
+		t.Errorf("status = %d, want 204", rec.Code)
+	}
+	if got != userID {
+		t.Errorf("user ID in context = %v, want %v", got, userID)
+	}
+}
+
+func TestJWKSWithHMACOnly(t *testing.T) {
+	keys, err := loadKeyring("", "", "", "test_secret_key")
+	if err != nil {
+		t.Fatalf("loadKeyring() error = %v", err)
+	}
+	cfg := &apiConfig{JWTKeys: keys}
+
+	rec := httptest.NewRecorder()
+	cfg.jwks(rec, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+
+	if rec.Code != 404 {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+}
+
+func TestLoadKeyringErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		keys      string
+		activeKid string
+		secret    string
+	}{
+		{name: "no secret", secret: ""},
+		{name: "malformed entry", keys: "no-equals-sign"},
+		{name: "missing file", keys: "k1=/nonexistent/key.pem"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loadKeyring(tt.keys, tt.activeKid, "", tt.secret); err == nil {
+				t.Error("loadKeyring() expected error but got none")
+			}
+		})
+	}
+}
+
+func TestLoadKeyringRotation(t *testing.T) {
+	dir := t.TempDir()
+	writeKey := func(name, blockType string, der []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	newKey := func(name string) (priv, pub string) {
+		pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		privDER, err := x509.MarshalPKCS8PrivateKey(privKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubDER, err := x509.MarshalPKIXPublicKey(pubKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return writeKey(name+".pem", "PRIVATE KEY", privDER), writeKey(name+".pub.pem", "PUBLIC KEY", pubDER)
+	}
+	oldPriv, oldPub := newKey("old")
+	newPriv, _ := newKey("new")
+
+	before, err := loadKeyring("old="+oldPriv, "", "", "")
+	if err != nil {
+		t.Fatalf("loadKeyring() error = %v", err)
+	}
+	oldToken, err := before.MakeJWT(uuid.New(), "user", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+
+	// The old key is kept as verify-only while the new one signs.
+	ring, err := loadKeyring("old="+oldPub+",new="+newPriv, "", "", "")
+	if err != nil {
+		t.Fatalf("loadKeyring() error = %v", err)
+	}
+	if _, err := ring.ValidateJWT(oldToken); err != nil {
+		t.Errorf("ValidateJWT() of a token from the verify-only key: %v", err)
+	}
+	if _, err := ring.MakeJWT(uuid.New(), "user", time.Hour); err != nil {
+		t.Errorf("MakeJWT() error = %v; the private key should be active", err)
+	}
+	if _, err := loadKeyring("old="+oldPub+",new="+newPriv, "old", "", ""); err == nil {
+		t.Error("loadKeyring() made a verify-only key active")
+	}
+
+	if err := retireKeys(ring, "old"); err != nil {
+		t.Fatalf("retireKeys() error = %v", err)
+	}
+	if _, err := ring.ValidateJWT(oldToken); err == nil {
+		t.Error("ValidateJWT() accepted a token from a retired key")
+	}
+	if err := retireKeys(ring, "missing"); err == nil {
+		t.Error("retireKeys() of an unknown kid expected error but got none")
+	}
+}
+
+func TestLoadPasswordPolicy(t *testing.T) {
+	env := map[string]string{
+		"PASSWORD_MIN_LENGTH": "12",
+		"PASSWORD_MAX_BYTES":  "128",
+		"PASSWORD_REQUIRE":    "upper, digit",
+	}
+	p, err := loadPasswordPolicy(func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatalf("loadPasswordPolicy() error = %v", err)
+	}
+	if p.MinLength != 12 || p.MaxBytes != 128 || !p.RequireUpper || !p.RequireDigit || p.RequireLower || p.RequireSymbol {
+		t.Errorf("loadPasswordPolicy() = %+v", p)
+	}
+
+	for _, bad := range []map[string]string{
+		{"PASSWORD_MIN_LENGTH": "-1"},
+		{"PASSWORD_MAX_BYTES": "lots"},
+		{"PASSWORD_REQUIRE": "emoji"},
+		{"PASSWORD_BREACH_LIST": "/nonexistent/breached.txt"},
+	} {
+		if _, err := loadPasswordPolicy(func(k string) string { return bad[k] }); err == nil {
+			t.Errorf("loadPasswordPolicy(%v) expected error but got none", bad)
+		}
+	}
+}
+
+func TestUserAddRejectsWeakPassword(t *testing.T) {
+	cfg := &apiConfig{PasswordPolicy: auth.DefaultPasswordPolicy}
+
+	req := httptest.NewRequest("POST", "/api/users", strings.NewReader(`{"email":"a@example.com","password":""}`))
+	rec := httptest.NewRecorder()
+	cfg.userAdd(rec, req)
+
+	if rec.Code != 422 {
+		t.Fatalf("status = %d, want 422", rec.Code)
+	}
+	var body struct {
+		FailedRules []string `json:"failed_rules"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode body: %v", err)
+	}
+	if len(body.FailedRules) != 1 || body.FailedRules[0] != auth.RuleMinLength {
+		t.Errorf("failed_rules = %v, want [%s]", body.FailedRules, auth.RuleMinLength)
+	}
+}
+
+// newDBConfig returns an apiConfig backed by a freshly migrated database,
+// skipping the test when none is configured.
+func newDBConfig(tb testing.TB) *apiConfig {
+	tb.Helper()
+	db := dbtest.Open(tb)
+	return &apiConfig{db: db, dbQueries: database.New(db), FanoutLimit: defaultFanoutLimit}
+}
+
+// createTestUser adds a user to cfg's database and returns their ID.
+func createTestUser(tb testing.TB, cfg *apiConfig, email string) uuid.UUID {
+	tb.Helper()
+	user, err := cfg.dbQueries.CreateUser(context.Background(), database.CreateUserParams{Email: email, HashedPassword: "x"})
+	if err != nil {
+		tb.Fatalf("CreateUser() error = %v", err)
+	}
+	return user.ID
+}
+
+// requestAs returns a request authenticated as userID, as it reaches a
+// handler behind middlewareTokenAuth. A nil userID makes it anonymous.
+func requestAs(userID uuid.UUID, method, target, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if userID != uuid.Nil {
+		req = req.WithContext(context.WithValue(req.Context(), userIDKey, userID))
+	}
+	return req
+}
+
+// postChirp calls addChirp as userID and returns the chirp created, if
+// any, and the response status.
+func postChirp(t *testing.T, cfg *apiConfig, userID uuid.UUID, msg ChirpyMessage) (Chirp, int) {
+	t.Helper()
+	body, _ := json.Marshal(msg)
+	rec := httptest.NewRecorder()
+	cfg.addChirp(rec, requestAs(userID, "POST", "/api/chirps", string(body)))
+	var chirp Chirp
+	if rec.Code == 201 {
+		if err := json.Unmarshal(rec.Body.Bytes(), &chirp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return chirp, rec.Code
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/deoreal/chirpy/internal/database"
+	"github.com/deoreal/chirpy/internal/oidc"
+)
+
+const (
+	oidcLoginTTL    = 10 * time.Minute
+	oidcStateCookie = "chirpy_oidc_state"
+	oidcCookiePath  = "/api/oidc/"
+)
+
+// errUnverifiedAccount is returned when single sign-on would link to a
+// local account whose owner never proved control of the email address.
+// Linking would hand the account, and its password, to whoever signs in.
+var errUnverifiedAccount = errors.New("an unverified account already uses this email")
+
+// loadOIDC configures single sign-on from OIDC_ISSUER, OIDC_CLIENT_ID,
+// OIDC_CLIENT_SECRET, OIDC_REDIRECT_URL (defaulting to the callback under
+// baseURL) and OIDC_SCOPES. SSO is disabled when OIDC_ISSUER is unset.
+func loadOIDC(getenv func(string) string, baseURL string) (*oidc.Client, error) {
+	issuer := getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+	redirect := getenv("OIDC_REDIRECT_URL")
+	if redirect == "" {
+		redirect = strings.TrimSuffix(baseURL, "/") + "/api/oidc/callback"
+	}
+
+	return oidc.NewClient(oidc.Config{
+		Issuer:       issuer,
+		ClientID:     getenv("OIDC_CLIENT_ID"),
+		ClientSecret: getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  redirect,
+		Scopes:       strings.Fields(strings.ReplaceAll(getenv("OIDC_SCOPES"), ",", " ")),
+	})
+}
+
+// oidcLogin starts a single sign-on login by redirecting to the provider.
+// The state is also set as a cookie so the callback can check it comes
+// back to the browser that started the login.
+func (cfg *apiConfig) oidcLogin(w http.ResponseWriter, req *http.Request) {
+	if cfg.OIDC == nil {
+		w.WriteHeader(404)
+		js, _ := json.Marshal(jsonError{Error: "Single sign-on is not configured"})
+		w.Write(js)
+		return
+	}
+
+	var values [3]string
+	for i := range values {
+		v, err := oidc.NewState()
+		if err != nil {
+			log.Printf("Error starting sso login %s", err)
+			w.WriteHeader(500)
+			js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+			w.Write(js)
+			return
+		}
+		values[i] = v
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	if err := cfg.dbQueries.DeleteExpiredOIDCLogins(req.Context()); err != nil {
+		log.Printf("Error deleting expired sso logins %s", err)
+	}
+	err := cfg.dbQueries.CreateOIDCLogin(req.Context(), database.CreateOIDCLoginParams{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().UTC().Add(oidcLoginTTL),
+	})
+	if err != nil {
+		log.Printf("Error storing sso login %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	authURL, err := cfg.OIDC.AuthCodeURL(req.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Printf("Error contacting identity provider %s", err)
+		w.WriteHeader(502)
+		js, _ := json.Marshal(jsonError{Error: "Identity provider unavailable"})
+		w.Write(js)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     oidcCookiePath,
+		MaxAge:   int(oidcLoginTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(cfg.BaseURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, req, authURL, http.StatusFound)
+}
+
+// oidcCallback completes a single sign-on login. The provider's verified
+// email is linked to an existing user or creates a new one, then the login
+// continues exactly like a password login.
+func (cfg *apiConfig) oidcCallback(w http.ResponseWriter, req *http.Request) {
+	if cfg.OIDC == nil {
+		w.WriteHeader(404)
+		js, _ := json.Marshal(jsonError{Error: "Single sign-on is not configured"})
+		w.Write(js)
+		return
+	}
+
+	q := req.URL.Query()
+	if e := q.Get("error"); e != "" {
+		log.Printf("Identity provider refused login: %s %s", e, q.Get("error_description"))
+		w.WriteHeader(401)
+		js, _ := json.Marshal(jsonError{Error: "Unauthorized"})
+		w.Write(js)
+		return
+	}
+
+	state := q.Get("state")
+	cookie, err := req.Cookie(oidcStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		w.WriteHeader(400)
+		js, _ := json.Marshal(jsonError{Error: "Invalid state"})
+		w.Write(js)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: oidcCookiePath, MaxAge: -1})
+
+	pending, err := cfg.dbQueries.ConsumeOIDCLogin(req.Context(), state)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(400)
+			js, _ := json.Marshal(jsonError{Error: "Login expired, please try again"})
+			w.Write(js)
+			return
+		}
+		log.Printf("Error db query %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	idToken, err := cfg.OIDC.Exchange(req.Context(), q.Get("code"), pending.CodeVerifier, pending.Nonce)
+	if err != nil {
+		log.Printf("Error completing sso login %s", err)
+		w.WriteHeader(401)
+		js, _ := json.Marshal(jsonError{Error: "Unauthorized"})
+		w.Write(js)
+		return
+	}
+	if idToken.Email == "" || !idToken.EmailVerified {
+		w.WriteHeader(403)
+		js, _ := json.Marshal(jsonError{Error: "Identity provider did not return a verified email"})
+		w.Write(js)
+		return
+	}
+
+	user, err := cfg.ssoUser(req, idToken.Email)
+	if err != nil {
+		if errors.Is(err, errUnverifiedAccount) {
+			w.WriteHeader(409)
+			js, _ := json.Marshal(jsonError{Error: "An unverified account already uses this email; verify it first"})
+			w.Write(js)
+			return
+		}
+		log.Printf("Error linking sso user %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	twoFactor, err := cfg.twoFactorEnabled(req.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error loading two-factor settings %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+	if twoFactor {
+		cfg.writeTwoFactorChallenge(w, user.ID)
+		return
+	}
+
+	cfg.issueLoginTokens(w, req, user, accessTokenExpiry)
+}
+
+// ssoUser returns the user with email, creating a password-less user if
+// there is none.
+func (cfg *apiConfig) ssoUser(req *http.Request, email string) (database.User, error) {
+	user, err := cfg.dbQueries.GetUser(req.Context(), email)
+	if errors.Is(err, sql.ErrNoRows) {
+		user, err = cfg.dbQueries.CreateSSOUser(req.Context(), email)
+		if isUniqueViolation(err) {
+			// Lost a race with a concurrent sign-up; use that user.
+			user, err = cfg.dbQueries.GetUser(req.Context(), email)
+		}
+	}
+	if err != nil {
+		return database.User{}, err
+	}
+	if !user.EmailVerifiedAt.Valid {
+		return database.User{}, errUnverifiedAccount
+	}
+
+	return user, nil
+}
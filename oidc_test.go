@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/deoreal/chirpy/internal/oidc"
+)
+
+func TestLoadOIDC(t *testing.T) {
+	env := func(m map[string]string) func(string) string {
+		return func(k string) string { return m[k] }
+	}
+
+	c, err := loadOIDC(env(nil), "http://localhost:8080")
+	if err != nil || c != nil {
+		t.Errorf("loadOIDC() without OIDC_ISSUER = %v, %v; want nil, nil", c, err)
+	}
+
+	if _, err := loadOIDC(env(map[string]string{"OIDC_ISSUER": "https://idp.example"}), "http://localhost:8080"); err == nil {
+		t.Error("loadOIDC() accepted a config without OIDC_CLIENT_ID")
+	}
+
+	c, err = loadOIDC(env(map[string]string{
+		"OIDC_ISSUER":    "https://idp.example",
+		"OIDC_CLIENT_ID": "chirpy",
+		"OIDC_SCOPES":    "email,profile",
+	}), "http://localhost:8080")
+	if err != nil || c == nil {
+		t.Errorf("loadOIDC() = %v, %v; want a client", c, err)
+	}
+}
+
+func TestOIDCDisabled(t *testing.T) {
+	cfg := &apiConfig{}
+	for _, h := range []http.HandlerFunc{cfg.oidcLogin, cfg.oidcCallback} {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest("GET", "/api/oidc/login", nil))
+		if rec.Code != 404 {
+			t.Errorf("status = %d, want 404", rec.Code)
+		}
+	}
+}
+
+func TestOIDCCallbackChecksState(t *testing.T) {
+	client, err := oidc.NewClient(oidc.Config{
+		Issuer:      "https://idp.example",
+		ClientID:    "chirpy",
+		RedirectURL: "http://localhost:8080/api/oidc/callback",
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	cfg := &apiConfig{OIDC: client}
+
+	tests := []struct {
+		name   string
+		query  string
+		cookie string
+		want   int
+	}{
+		{name: "provider error", query: "?error=access_denied&state=abc", cookie: "abc", want: 401},
+		{name: "no cookie", query: "?code=c&state=abc", want: 400},
+		{name: "no state", query: "?code=c", cookie: "abc", want: 400},
+		{name: "mismatched state", query: "?code=c&state=abc", cookie: "abd", want: 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/oidc/callback"+tt.query, nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: tt.cookie})
+			}
+			rec := httptest.NewRecorder()
+			cfg.oidcCallback(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/deoreal/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// rechirp shares a chirp with the caller's followers. Each user can
+// rechirp a chirp once; rechirping a rechirp shares the original.
+func (cfg *apiConfig) rechirp(w http.ResponseWriter, req *http.Request) {
+	userID, _ := userIDFromContext(req.Context())
+	chirpID, ok := chirpTarget(w, req)
+	if !ok {
+		return
+	}
+	if !cfg.requireVerifiedEmail(w, req, userID) {
+		return
+	}
+
+	original, err := cfg.dbQueries.GetChirpById(req.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(404)
+			js, _ := json.Marshal(jsonError{Error: "Chirp not found"})
+			w.Write(js)
+			return
+		}
+		log.Printf("Error db query %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+	if original.RechirpOfID.Valid {
+		original.ID = original.RechirpOfID.UUID
+	}
+
+	chr, err := cfg.dbQueries.CreateRechirp(req.Context(), database.CreateRechirpParams{
+		UserID:      userID,
+		RechirpOfID: uuid.NullUUID{UUID: original.ID, Valid: true},
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			w.WriteHeader(409)
+			js, _ := json.Marshal(jsonError{Error: "You have already rechirped this chirp"})
+			w.Write(js)
+			return
+		}
+		if isForeignKeyViolation(err) {
+			w.WriteHeader(404)
+			js, _ := json.Marshal(jsonError{Error: "Chirp not found"})
+			w.Write(js)
+			return
+		}
+		log.Printf("Error creating rechirp %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+	cfg.fanOut(chr)
+
+	chirps := []Chirp{chirpFromDB(chr)}
+	if err := cfg.annotateChirps(req.Context(), chirps); err != nil {
+		log.Printf("Error db query %s", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(201)
+	js, _ := json.Marshal(chirps[0])
+	w.Write(js)
+}
+
+// undoRechirp removes the caller's rechirp of a chirp. Like unlikeChirp it
+// is idempotent. Rechirps of a rechirp are of its original, so the target
+// is resolved the same way as in rechirp.
+func (cfg *apiConfig) undoRechirp(w http.ResponseWriter, req *http.Request) {
+	userID, _ := userIDFromContext(req.Context())
+	chirpID, ok := chirpTarget(w, req)
+	if !ok {
+		return
+	}
+
+	target, err := cfg.dbQueries.GetChirpById(req.Context(), chirpID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error db query %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+	if target.RechirpOfID.Valid {
+		chirpID = target.RechirpOfID.UUID
+	}
+
+	_, err = cfg.dbQueries.DeleteRechirp(req.Context(), database.DeleteRechirpParams{
+		UserID:      userID,
+		RechirpOfID: uuid.NullUUID{UUID: chirpID, Valid: true},
+	})
+	if err != nil {
+		log.Printf("Error deleting rechirp %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	w.WriteHeader(204)
+}
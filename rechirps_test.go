@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/deoreal/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestChirpFromDBSharedChirps(t *testing.T) {
+	original := uuid.New()
+
+	rechirp := chirpFromDB(database.Chirpmsg{ID: uuid.New(), RechirpOfID: uuid.NullUUID{UUID: original, Valid: true}})
+	if id, ok := rechirp.originalID(); !ok || id != original {
+		t.Errorf("rechirp originalID() = %v, %v; want %v", id, ok, original)
+	}
+	if rechirp.QuoteOfID != nil {
+		t.Errorf("rechirp QuoteOfID = %v, want nil", rechirp.QuoteOfID)
+	}
+
+	quote := chirpFromDB(database.Chirpmsg{ID: uuid.New(), Body: "this", QuoteOfID: uuid.NullUUID{UUID: original, Valid: true}})
+	if id, ok := quote.originalID(); !ok || id != original {
+		t.Errorf("quote originalID() = %v, %v; want %v", id, ok, original)
+	}
+
+	if _, ok := chirpFromDB(database.Chirpmsg{ID: uuid.New()}).originalID(); ok {
+		t.Error("plain chirp has an original")
+	}
+}
+
+func TestAddChirpRejectsEmptyQuote(t *testing.T) {
+	cfg := &apiConfig{}
+
+	body := `{"body": "", "quote_of_id": "` + uuid.NewString() + `"}`
+	req := httptest.NewRequest("POST", "/api/chirps", strings.NewReader(body))
+	req = req.WithContext(context.WithValue(req.Context(), userIDKey, uuid.New()))
+	rec := httptest.NewRecorder()
+	cfg.addChirp(rec, req)
+
+	if rec.Code != 400 {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+}
+
+func TestRechirpsAndQuotes(t *testing.T) {
+	cfg := newDBConfig(t)
+	ctx := context.Background()
+	alice := createTestUser(t, cfg, "alice@example.com")
+	bob := createTestUser(t, cfg, "bob@example.com")
+	carol := createTestUser(t, cfg, "carol@example.com")
+
+	original, code := postChirp(t, cfg, alice, ChirpyMessage{Body: "original"})
+	if code != 201 {
+		t.Fatalf("addChirp status = %d, want 201", code)
+	}
+
+	call := func(h http.HandlerFunc, userID, chirpID uuid.UUID) (Chirp, int) {
+		t.Helper()
+		req := requestAs(userID, "POST", "/api/chirps/x/rechirp", "")
+		req.SetPathValue("chirpID", chirpID.String())
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		var chirp Chirp
+		if rec.Code == 201 {
+			if err := json.Unmarshal(rec.Body.Bytes(), &chirp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return chirp, rec.Code
+	}
+	sharesOriginal := func(name string, c Chirp) {
+		t.Helper()
+		id, ok := c.originalID()
+		if !ok || id != original.ID || c.Original == nil || c.Original.Body != "original" {
+			t.Errorf("%s does not embed the original: %+v", name, c)
+		}
+	}
+
+	bobs, code := call(cfg.rechirp, bob, original.ID)
+	if code != 201 || bobs.RechirpOfID == nil {
+		t.Fatalf("rechirp status = %d, want 201", code)
+	}
+	sharesOriginal("rechirp", bobs)
+	if _, code := call(cfg.rechirp, bob, original.ID); code != 409 {
+		t.Errorf("repeated rechirp: status = %d, want 409", code)
+	}
+	if _, code := call(cfg.rechirp, bob, uuid.New()); code != 404 {
+		t.Errorf("rechirping a missing chirp: status = %d, want 404", code)
+	}
+
+	// Rechirping or quoting a rechirp shares the chirp it rechirped.
+	carols, code := call(cfg.rechirp, carol, bobs.ID)
+	if code != 201 || carols.RechirpOfID == nil {
+		t.Fatalf("rechirp of a rechirp: status = %d, want 201", code)
+	}
+	sharesOriginal("rechirp of a rechirp", carols)
+	quote, code := postChirp(t, cfg, carol, ChirpyMessage{Body: "look at this", QuoteOfID: &bobs.ID})
+	if code != 201 || quote.QuoteOfID == nil {
+		t.Fatalf("quote status = %d, want 201", code)
+	}
+	sharesOriginal("quote", quote)
+	missing := uuid.New()
+	if _, code := postChirp(t, cfg, carol, ChirpyMessage{Body: "lost", QuoteOfID: &missing}); code != 400 {
+		t.Errorf("quoting a missing chirp: status = %d, want 400", code)
+	}
+
+	cfg.RequireVerifiedEmail = true
+	if _, code := call(cfg.rechirp, alice, quote.ID); code != 403 {
+		t.Errorf("rechirp by an unverified user: status = %d, want 403", code)
+	}
+	cfg.RequireVerifiedEmail = false
+
+	for range 2 {
+		if _, code := call(cfg.undoRechirp, bob, original.ID); code != 204 {
+			t.Fatalf("undoRechirp status = %d, want 204", code)
+		}
+	}
+	bobs, code = call(cfg.rechirp, bob, original.ID)
+	if code != 201 {
+		t.Fatalf("rechirp after undo: status = %d, want 201", code)
+	}
+
+	// Undoing via a rechirp's ID undoes the rechirp of its original.
+	if _, code := call(cfg.undoRechirp, carol, bobs.ID); code != 204 {
+		t.Fatalf("undoRechirp of a rechirp: status = %d, want 204", code)
+	}
+	if _, err := cfg.dbQueries.GetChirpById(ctx, carols.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("undone rechirp: GetChirpById() error = %v, want sql.ErrNoRows", err)
+	}
+	carols, code = call(cfg.rechirp, carol, bobs.ID)
+	if code != 201 {
+		t.Fatalf("rechirp of a rechirp after undo: status = %d, want 201", code)
+	}
+
+	// Rechirps go with the original; quotes keep their own body.
+	if err := cfg.dbQueries.DeleteChirp(ctx, original.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.dbQueries.GetChirpById(ctx, carols.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("rechirp of a deleted chirp: GetChirpById() error = %v, want sql.ErrNoRows", err)
+	}
+	kept, err := cfg.dbQueries.GetChirpById(ctx, quote.ID)
+	if err != nil || kept.QuoteOfID.Valid {
+		t.Errorf("quote of a deleted chirp = %+v, %v; want it kept without quote_of_id", kept, err)
+	}
+}
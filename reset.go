@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/deoreal/chirpy/internal/auth"
+	"github.com/deoreal/chirpy/internal/database"
+)
+
+// fixtures describe the known state POST /admin/reset restores. Passwords
+// are given in clear and hashed when seeded; they skip the password policy.
+type fixtures struct {
+	Users []fixtureUser `json:"users"`
+}
+
+type fixtureUser struct {
+	Email         string   `json:"email"`
+	Password      string   `json:"password"`
+	Role          string   `json:"role"`
+	IsChirpyRed   bool     `json:"is_chirpy_red"`
+	EmailVerified bool     `json:"email_verified"`
+	Chirps        []string `json:"chirps"`
+}
+
+// loadFixtures reads and checks a fixtures file so that mistakes surface at
+// startup rather than halfway through a reset.
+func loadFixtures(path string) (*fixtures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures: %s", err)
+	}
+	var f fixtures
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse fixtures %s: %s", path, err)
+	}
+
+	emails := map[string]bool{}
+	bodies := map[string]bool{}
+	for i, u := range f.Users {
+		if u.Email == "" || u.Password == "" {
+			return nil, fmt.Errorf("fixture user %d needs an email and a password", i)
+		}
+		if emails[u.Email] {
+			return nil, fmt.Errorf("duplicate fixture user %s", u.Email)
+		}
+		emails[u.Email] = true
+		if _, ok := roleRank[u.Role]; u.Role != "" && !ok {
+			return nil, fmt.Errorf("fixture user %s has unknown role %q", u.Email, u.Role)
+		}
+		for _, body := range u.Chirps {
+			if body == "" || len(body) > 140 {
+				return nil, fmt.Errorf("fixture user %s has a chirp that is empty or longer than 140 characters", u.Email)
+			}
+			if bodies[body] {
+				return nil, fmt.Errorf("duplicate fixture chirp %q", body)
+			}
+			bodies[body] = true
+		}
+	}
+
+	return &f, nil
+}
+
+// seed inserts the fixtures using q. It returns the number of users and
+// chirps created.
+func (f *fixtures) seed(ctx context.Context, q *database.Queries) (int, int, error) {
+	var chirps int
+	for _, u := range f.Users {
+		hash, err := auth.HashPassword(u.Password)
+		if err != nil {
+			return 0, 0, err
+		}
+		user, err := q.CreateUser(ctx, database.CreateUserParams{Email: u.Email, HashedPassword: hash})
+		if err != nil {
+			return 0, 0, fmt.Errorf("creating %s: %s", u.Email, err)
+		}
+		if u.Role != "" && u.Role != roleUser {
+			if _, err := q.SetUserRole(ctx, database.SetUserRoleParams{ID: user.ID, Role: u.Role}); err != nil {
+				return 0, 0, fmt.Errorf("setting role of %s: %s", u.Email, err)
+			}
+		}
+		if u.IsChirpyRed {
+			if _, err := q.UpgradeUserToChirpyRed(ctx, user.ID); err != nil {
+				return 0, 0, fmt.Errorf("upgrading %s: %s", u.Email, err)
+			}
+		}
+		if u.EmailVerified {
+			if _, err := q.MarkEmailVerified(ctx, database.MarkEmailVerifiedParams{ID: user.ID, Email: user.Email}); err != nil {
+				return 0, 0, fmt.Errorf("verifying %s: %s", u.Email, err)
+			}
+		}
+		for _, body := range u.Chirps {
+			if _, err := q.CreateChirp(ctx, database.CreateChirpParams{Body: body, UserID: user.ID}); err != nil {
+				return 0, 0, fmt.Errorf("creating chirp for %s: %s", u.Email, err)
+			}
+			chirps++
+		}
+	}
+
+	return len(f.Users), chirps, nil
+}
+
+// reset empties the database and reseeds cfg.Fixtures. It only runs when
+// PLATFORM=dev.
+func (cfg *apiConfig) reset(w http.ResponseWriter, req *http.Request) {
+	type resetResponse struct {
+		Users  int `json:"users"`
+		Chirps int `json:"chirps"`
+	}
+
+	if cfg.Platform != "dev" {
+		w.WriteHeader(403)
+		js, _ := json.Marshal(jsonError{Error: "Reset is only allowed in dev environment"})
+		w.Write(js)
+		return
+	}
+
+	users, chirps, err := cfg.resetDatabase(req.Context())
+	if err != nil {
+		log.Printf("Error resetting database %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+	cfg.fileserverHits.Store(0)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	js, _ := json.Marshal(resetResponse{Users: users, Chirps: chirps})
+	w.Write(js)
+}
+
+// resetDatabase empties the database and seeds cfg.Fixtures in one
+// transaction, so a failed seed leaves the previous state in place.
+func (cfg *apiConfig) resetDatabase(ctx context.Context) (int, int, error) {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	if err := qtx.ResetDatabase(ctx); err != nil {
+		return 0, 0, err
+	}
+	var users, chirps int
+	if cfg.Fixtures != nil {
+		users, chirps, err = cfg.Fixtures.seed(ctx, qtx)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return users, chirps, tx.Commit()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResetRequiresDevPlatform(t *testing.T) {
+	for _, platform := range []string{"", "prod", "DEV"} {
+		cfg := &apiConfig{Platform: platform}
+		rec := httptest.NewRecorder()
+		cfg.reset(rec, httptest.NewRequest("POST", "/admin/reset", nil))
+
+		if rec.Code != 403 {
+			t.Errorf("PLATFORM=%q: status = %d, want 403", platform, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), `"error"`) {
+			t.Errorf("PLATFORM=%q: body %s is not a JSON error", platform, rec.Body.String())
+		}
+	}
+}
+
+func TestLoadFixtures(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			content: `{"users": [
+				{"email": "admin@example.com", "password": "correct horse", "role": "admin", "chirps": ["hello"]},
+				{"email": "bob@example.com", "password": "battery staple", "is_chirpy_red": true}
+			]}`,
+		},
+		{name: "malformed", content: `{"users": [`, wantErr: "failed to parse"},
+		{name: "missing password", content: `{"users": [{"email": "a@example.com"}]}`, wantErr: "needs an email and a password"},
+		{
+			name:    "duplicate email",
+			content: `{"users": [{"email": "a@example.com", "password": "x"}, {"email": "a@example.com", "password": "y"}]}`,
+			wantErr: "duplicate fixture user",
+		},
+		{name: "unknown role", content: `{"users": [{"email": "a@example.com", "password": "x", "role": "root"}]}`, wantErr: "unknown role"},
+		{
+			name:    "duplicate chirp",
+			content: `{"users": [{"email": "a@example.com", "password": "x", "chirps": ["hi", "hi"]}]}`,
+			wantErr: "duplicate fixture chirp",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "fixtures.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := loadFixtures(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("loadFixtures() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadFixtures() error = %v", err)
+			}
+			if len(f.Users) != 2 || f.Users[0].Role != roleAdmin || !f.Users[1].IsChirpyRed {
+				t.Errorf("loadFixtures() = %+v", f)
+			}
+		})
+	}
+}
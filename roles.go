@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/deoreal/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Roles, in increasing order of privilege. Each role can do everything the
+// roles before it can.
+const (
+	roleUser      = "user"
+	roleModerator = "moderator"
+	roleAdmin     = "admin"
+)
+
+var roleRank = map[string]int{
+	roleUser:      0,
+	roleModerator: 1,
+	roleAdmin:     2,
+}
+
+// roleFromContext returns the role stored by middlewareTokenAuth. Tokens
+// issued before roles existed carry none and count as roleUser.
+func roleFromContext(ctx context.Context) string {
+	role, _ := ctx.Value(roleKey).(string)
+	if role == "" {
+		return roleUser
+	}
+	return role
+}
+
+// hasRole reports whether role grants at least the privileges of want.
+func hasRole(role, want string) bool {
+	have, ok := roleRank[role]
+	return ok && have >= roleRank[want]
+}
+
+// requireRole authenticates the request with middlewareTokenAuth and only
+// calls next if the token's role is at least role. API keys are never
+// accepted.
+func (cfg *apiConfig) requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return cfg.middlewareTokenAuth(func(w http.ResponseWriter, r *http.Request) {
+		if !hasRole(roleFromContext(r.Context()), role) {
+			w.WriteHeader(403)
+			js, _ := json.Marshal(jsonError{Error: "Forbidden"})
+			w.Write(js)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setUserRole changes a user's role. Roles are carried in access tokens,
+// so the user's sessions are revoked and they have to log in again to act
+// with the new role.
+func (cfg *apiConfig) setUserRole(w http.ResponseWriter, req *http.Request) {
+	type roleRequest struct {
+		Role string `json:"role"`
+	}
+
+	userID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		w.WriteHeader(404)
+		js, _ := json.Marshal(jsonError{Error: "User not found"})
+		w.Write(js)
+		return
+	}
+
+	var rr roleRequest
+	decoder := json.NewDecoder(req.Body)
+	err = decoder.Decode(&rr)
+	if _, ok := roleRank[rr.Role]; err != nil || !ok {
+		log.Printf("Error decoding json parameters: %v", err)
+		w.WriteHeader(400)
+		js, _ := json.Marshal(jsonError{Error: "role must be one of user, moderator, admin"})
+		w.Write(js)
+		return
+	}
+
+	if actorID, _ := userIDFromContext(req.Context()); actorID == userID && rr.Role != roleAdmin {
+		w.WriteHeader(409)
+		js, _ := json.Marshal(jsonError{Error: "Admins cannot demote themselves"})
+		w.Write(js)
+		return
+	}
+
+	user, err := cfg.changeRole(req.Context(), userID, rr.Role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(404)
+			js, _ := json.Marshal(jsonError{Error: "User not found"})
+			w.Write(js)
+			return
+		}
+		log.Printf("Error updating role %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+	usr := User{ID: user.ID, CreatedAt: user.CreatedAt, UpdatedAt: user.UpdatedAt, Email: user.Email, HashedPassword: "***", IsChirpyRed: user.IsChirpyRed, EmailVerified: user.EmailVerifiedAt.Valid, Role: user.Role}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	js, _ := json.Marshal(usr)
+	w.Write(js)
+}
+
+// changeRole sets userID's role and, if it changed, revokes every session
+// and refresh token they hold in the same transaction.
+func (cfg *apiConfig) changeRole(ctx context.Context, userID uuid.UUID, role string) (database.User, error) {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	current, err := qtx.GetUserByID(ctx, userID)
+	if err != nil {
+		return database.User{}, err
+	}
+	if current.Role == role {
+		return current, nil
+	}
+
+	user, err := qtx.SetUserRole(ctx, database.SetUserRoleParams{ID: userID, Role: role})
+	if err != nil {
+		return database.User{}, err
+	}
+	if err := qtx.RevokeUserSessions(ctx, userID); err != nil {
+		return database.User{}, err
+	}
+	if err := qtx.RevokeUserRefreshTokens(ctx, userID); err != nil {
+		return database.User{}, err
+	}
+
+	return user, tx.Commit()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestHasRole(t *testing.T) {
+	tests := []struct {
+		role, want string
+		ok         bool
+	}{
+		{roleUser, roleUser, true},
+		{roleUser, roleModerator, false},
+		{roleModerator, roleModerator, true},
+		{roleModerator, roleAdmin, false},
+		{roleAdmin, roleModerator, true},
+		{"superuser", roleUser, false},
+	}
+
+	for _, tt := range tests {
+		if got := hasRole(tt.role, tt.want); got != tt.ok {
+			t.Errorf("hasRole(%q, %q) = %v, want %v", tt.role, tt.want, got, tt.ok)
+		}
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	keys, err := loadKeyring("", "", "", "test_secret_key")
+	if err != nil {
+		t.Fatalf("loadKeyring() error = %v", err)
+	}
+	cfg := &apiConfig{JWTKeys: keys}
+
+	h := cfg.requireRole(roleModerator, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	})
+
+	tests := []struct {
+		name string
+		role string
+		want int
+	}{
+		{name: "no token", want: 401},
+		{name: "no role claim", role: "", want: 403},
+		{name: "user", role: roleUser, want: 403},
+		{name: "moderator", role: roleModerator, want: 204},
+		{name: "admin", role: roleAdmin, want: 204},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/admin/metrics", nil)
+			if tt.name != "no token" {
+				token, err := keys.MakeJWT(uuid.New(), tt.role, time.Hour)
+				if err != nil {
+					t.Fatalf("MakeJWT() error = %v", err)
+				}
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
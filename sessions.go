@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/deoreal/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// sessionTouchInterval limits how often an access token's use is written
+// back to its session.
+const sessionTouchInterval = time.Minute
+
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	Current    bool      `json:"current"`
+}
+
+// sessionIDFromContext returns the session of the access token that
+// authenticated the request, if it has one.
+func sessionIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	sessionID, ok := ctx.Value(sessionIDKey).(uuid.UUID)
+	return sessionID, ok
+}
+
+// checkSession verifies that the session named by an access token's sid
+// claim belongs to userID and has not been revoked or expired.
+func (cfg *apiConfig) checkSession(ctx context.Context, sid string, userID uuid.UUID) (uuid.UUID, error) {
+	sessionID, err := uuid.Parse(sid)
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("malformed session id: %s", err)
+	}
+
+	session, err := cfg.dbQueries.GetActiveSession(ctx, sessionID)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	if session.UserID != userID {
+		return uuid.UUID{}, errors.New("session belongs to another user")
+	}
+
+	if time.Since(session.LastUsedAt) > sessionTouchInterval {
+		if err := cfg.dbQueries.TouchSession(ctx, sessionID); err != nil {
+			log.Printf("Error recording session use %s", err)
+		}
+	}
+
+	return sessionID, nil
+}
+
+// revokeAllSessions logs userID out everywhere: every session and every
+// refresh token is revoked in one transaction.
+func (cfg *apiConfig) revokeAllSessions(ctx context.Context, userID uuid.UUID) error {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	if err := qtx.RevokeUserSessions(ctx, userID); err != nil {
+		return err
+	}
+	if err := qtx.RevokeUserRefreshTokens(ctx, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (cfg *apiConfig) listSessions(w http.ResponseWriter, req *http.Request) {
+	userID, _ := userIDFromContext(req.Context())
+	current, _ := sessionIDFromContext(req.Context())
+
+	dbSessions, err := cfg.dbQueries.ListActiveSessions(req.Context(), userID)
+	if err != nil {
+		log.Printf("Error db query %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	sessions := make([]Session, 0, len(dbSessions))
+	for _, s := range dbSessions {
+		sessions = append(sessions, Session{
+			ID:         s.ID,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+			ExpiresAt:  s.ExpiresAt,
+			UserAgent:  s.UserAgent,
+			IP:         s.Ip,
+			Current:    s.ID == current,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	js, _ := json.Marshal(sessions)
+	w.Write(js)
+}
+
+// revokeSession logs out a single session along with its refresh tokens.
+func (cfg *apiConfig) revokeSession(w http.ResponseWriter, req *http.Request) {
+	userID, _ := userIDFromContext(req.Context())
+
+	sessionID, err := uuid.Parse(req.PathValue("sessionID"))
+	if err != nil {
+		w.WriteHeader(404)
+		js, _ := json.Marshal(jsonError{Error: "Session not found"})
+		w.Write(js)
+		return
+	}
+
+	n, err := cfg.endSession(req.Context(), userID, sessionID)
+	if err != nil {
+		log.Printf("Error revoking session %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+	if n == 0 {
+		w.WriteHeader(404)
+		js, _ := json.Marshal(jsonError{Error: "Session not found"})
+		w.Write(js)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// endSession revokes one of userID's sessions and its refresh tokens. It
+// returns the number of sessions revoked.
+func (cfg *apiConfig) endSession(ctx context.Context, userID, sessionID uuid.UUID) (int64, error) {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	n, err := qtx.RevokeSession(ctx, database.RevokeSessionParams{ID: sessionID, UserID: userID})
+	if err != nil || n == 0 {
+		return n, err
+	}
+	if err := qtx.RevokeSessionRefreshTokens(ctx, uuid.NullUUID{UUID: sessionID, Valid: true}); err != nil {
+		return 0, err
+	}
+
+	return n, tx.Commit()
+}
+
+// revokeSessions is "log out everywhere", including the caller's session.
+func (cfg *apiConfig) revokeSessions(w http.ResponseWriter, req *http.Request) {
+	userID, _ := userIDFromContext(req.Context())
+
+	if err := cfg.revokeAllSessions(req.Context(), userID); err != nil {
+		log.Printf("Error revoking sessions %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	w.WriteHeader(204)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/deoreal/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestSessionIDFromContext(t *testing.T) {
+	if _, ok := sessionIDFromContext(context.Background()); ok {
+		t.Error("sessionIDFromContext() found a session in an empty context")
+	}
+
+	sessionID := uuid.New()
+	ctx := context.WithValue(context.Background(), sessionIDKey, sessionID)
+	if got, ok := sessionIDFromContext(ctx); !ok || got != sessionID {
+		t.Errorf("sessionIDFromContext() = %v, %v; want %v, true", got, ok, sessionID)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	cfg := newDBConfig(t)
+	ctx := context.Background()
+
+	alice := createTestUser(t, cfg, "alice@example.com")
+	bob := createTestUser(t, cfg, "bob@example.com")
+	newSession := func(userID uuid.UUID, agent string) uuid.UUID {
+		t.Helper()
+		s, err := cfg.dbQueries.CreateSession(ctx, database.CreateSessionParams{
+			UserID:    userID,
+			UserAgent: agent,
+			Ip:        "192.0.2.1",
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("CreateSession() error = %v", err)
+		}
+		return s.ID
+	}
+	laptop := newSession(alice, "laptop")
+	phone := newSession(alice, "phone")
+	bobs := newSession(bob, "desktop")
+
+	if _, err := cfg.checkSession(ctx, laptop.String(), alice); err != nil {
+		t.Errorf("checkSession() on an active session: %v", err)
+	}
+	if _, err := cfg.checkSession(ctx, bobs.String(), alice); err == nil {
+		t.Error("checkSession() accepted another user's session")
+	}
+
+	// listSessions marks the session the request was made with.
+	req := requestAs(alice, "GET", "/api/sessions", "")
+	req = req.WithContext(context.WithValue(req.Context(), sessionIDKey, phone))
+	rec := httptest.NewRecorder()
+	cfg.listSessions(rec, req)
+	var listed []Session
+	if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil || rec.Code != 200 {
+		t.Fatalf("listSessions = %d %s", rec.Code, rec.Body)
+	}
+	current := map[uuid.UUID]bool{}
+	for _, s := range listed {
+		current[s.ID] = s.Current
+	}
+	if len(current) != 2 || !current[phone] || current[laptop] {
+		t.Errorf("listSessions() = %+v, want laptop and current phone", listed)
+	}
+
+	revoke := func(userID, sessionID uuid.UUID) int {
+		req := requestAs(userID, "DELETE", "/api/sessions/x", "")
+		req.SetPathValue("sessionID", sessionID.String())
+		rec := httptest.NewRecorder()
+		cfg.revokeSession(rec, req)
+		return rec.Code
+	}
+	if code := revoke(bob, laptop); code != 404 {
+		t.Errorf("revoking another user's session: status = %d, want 404", code)
+	}
+	if code := revoke(alice, laptop); code != 204 {
+		t.Errorf("revokeSession status = %d, want 204", code)
+	}
+	if _, err := cfg.checkSession(ctx, laptop.String(), alice); err == nil {
+		t.Error("checkSession() accepted a revoked session")
+	}
+	if code := revoke(alice, laptop); code != 404 {
+		t.Errorf("revoking a session twice: status = %d, want 404", code)
+	}
+
+	rec = httptest.NewRecorder()
+	cfg.revokeSessions(rec, requestAs(alice, "DELETE", "/api/sessions", ""))
+	if rec.Code != 204 {
+		t.Fatalf("revokeSessions status = %d, want 204", rec.Code)
+	}
+	if _, err := cfg.checkSession(ctx, phone.String(), alice); err == nil {
+		t.Error("checkSession() accepted a session after logging out everywhere")
+	}
+	if _, err := cfg.checkSession(ctx, bobs.String(), bob); err != nil {
+		t.Errorf("logging out everywhere revoked another user's session: %v", err)
+	}
+}
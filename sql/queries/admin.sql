@@ -0,0 +1,3 @@
+-- name: ResetDatabase :exec
+-- CASCADE also empties every table that references users.
+TRUNCATE users, login_failures, lockout_events, oidc_logins CASCADE;
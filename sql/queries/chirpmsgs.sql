@@ -1,20 +1,93 @@
--- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirpmsgs
-ORDER BY created_at ASC;
-
-
 -- name: GetChirpById :one  
-SELECT id, created_at, updated_at, body, user_id FROM chirpmsgs
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, rechirp_of_id, quote_of_id FROM chirpmsgs
 WHERE id = $1;
 
 
 -- name: CreateChirp :one
-INSERT INTO chirpmsgs (id, created_at, updated_at, body, user_id)
+INSERT INTO chirpmsgs (id, created_at, updated_at, body, user_id, reply_to_id, quote_of_id)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: CreateRechirp :one
+INSERT INTO chirpmsgs (id, created_at, updated_at, body, user_id, rechirp_of_id)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    '',
+    $1,
     $2
 )
 RETURNING *;
+
+-- name: DeleteRechirp :execrows
+DELETE FROM chirpmsgs
+WHERE user_id = $1 AND rechirp_of_id = $2;
+
+-- name: DeleteChirp :exec
+DELETE FROM chirpmsgs
+WHERE id = $1;
+
+-- name: ListChirps :many
+SELECT * FROM chirpmsgs
+WHERE (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('row_limit');
+
+-- name: ListChirpsDesc :many
+SELECT * FROM chirpmsgs
+WHERE (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('row_limit');
+
+-- name: ListTimeline :many
+SELECT * FROM chirpmsgs
+WHERE (user_id = sqlc.arg('viewer_id')
+    OR user_id IN (SELECT followee_id FROM follows WHERE follower_id = sqlc.arg('viewer_id')))
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('row_limit');
+
+-- name: GetChirpsByIDs :many
+SELECT * FROM chirpmsgs
+WHERE id = ANY(sqlc.arg('ids')::uuid[]);
+
+-- name: CountReplies :many
+SELECT reply_to_id, COUNT(*) AS replies FROM chirpmsgs
+WHERE reply_to_id = ANY(sqlc.arg('ids')::uuid[])
+GROUP BY reply_to_id;
+
+-- name: ListChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT parent.*, 1 AS depth FROM chirpmsgs parent
+    WHERE parent.id = (SELECT child.reply_to_id FROM chirpmsgs child WHERE child.id = $1)
+    UNION ALL
+    SELECT c.*, a.depth + 1 FROM chirpmsgs c
+    JOIN ancestors a ON c.id = a.reply_to_id
+)
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, rechirp_of_id, quote_of_id FROM ancestors
+ORDER BY depth DESC;
+
+-- name: ListChirpDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT * FROM chirpmsgs
+    WHERE chirpmsgs.reply_to_id = $1
+    UNION ALL
+    SELECT c.* FROM chirpmsgs c
+    JOIN descendants d ON c.reply_to_id = d.id
+)
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, rechirp_of_id, quote_of_id FROM descendants
+ORDER BY created_at ASC, id ASC;
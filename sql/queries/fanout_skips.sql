@@ -0,0 +1,12 @@
+-- name: RecordFanoutSkip :exec
+INSERT INTO fanout_skips (chirp_id, user_id, created_at)
+VALUES ($1, $2, $3)
+ON CONFLICT DO NOTHING;
+
+-- name: ListFanoutSkips :many
+SELECT * FROM fanout_skips
+WHERE user_id IN (SELECT followee_id FROM follows WHERE follower_id = sqlc.arg('follower_id'))
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, chirp_id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, chirp_id DESC
+LIMIT sqlc.arg('row_limit');
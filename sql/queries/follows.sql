@@ -0,0 +1,42 @@
+-- name: FollowUser :execrows
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: UnfollowUser :execrows
+DELETE FROM follows
+WHERE follower_id = $1 AND followee_id = $2;
+
+-- name: ListFollowers :many
+SELECT follower_id AS user_id, created_at FROM follows
+WHERE followee_id = sqlc.arg('user_id')
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, follower_id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, follower_id DESC
+LIMIT sqlc.arg('row_limit');
+
+-- name: ListFollowing :many
+SELECT followee_id AS user_id, created_at FROM follows
+WHERE follower_id = sqlc.arg('user_id')
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, followee_id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, followee_id DESC
+LIMIT sqlc.arg('row_limit');
+
+-- name: IncrementFollowerCount :exec
+INSERT INTO follower_counts (user_id, followers)
+VALUES ($1, 1)
+ON CONFLICT (user_id) DO UPDATE SET followers = follower_counts.followers + 1;
+
+-- name: DecrementFollowerCount :exec
+UPDATE follower_counts
+SET followers = followers - 1
+WHERE user_id = $1;
+
+-- name: GetFollowerCount :one
+SELECT followers FROM follower_counts
+WHERE user_id = $1;
+
+-- name: ListFollowerIDs :many
+SELECT follower_id FROM follows
+WHERE followee_id = $1;
@@ -0,0 +1,36 @@
+-- name: GetLoginFailure :one
+SELECT * FROM login_failures
+WHERE kind = $1 AND subject = $2;
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_failures (kind, subject, failures, last_failure_at)
+VALUES ($1, $2, 1, NOW())
+ON CONFLICT (kind, subject) DO UPDATE
+SET failures = CASE
+        WHEN login_failures.last_failure_at < NOW() - INTERVAL '24 hours' THEN 1
+        ELSE login_failures.failures + 1
+    END,
+    last_failure_at = NOW()
+RETURNING *;
+
+-- name: LockLoginSubject :exec
+UPDATE login_failures
+SET locked_until = $3
+WHERE kind = $1 AND subject = $2;
+
+-- name: ClearLoginFailures :execrows
+DELETE FROM login_failures
+WHERE kind = $1 AND subject = $2;
+
+-- name: CreateLockoutEvent :exec
+INSERT INTO lockout_events (id, created_at, kind, subject, event, failures, locked_until, actor_id)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+);
@@ -0,0 +1,18 @@
+-- name: CreateOIDCLogin :exec
+INSERT INTO oidc_logins (state, created_at, nonce, code_verifier, expires_at)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4
+);
+
+-- name: ConsumeOIDCLogin :one
+DELETE FROM oidc_logins
+WHERE state = $1 AND expires_at > NOW()
+RETURNING *;
+
+-- name: DeleteExpiredOIDCLogins :exec
+DELETE FROM oidc_logins
+WHERE expires_at <= NOW();
@@ -0,0 +1,42 @@
+-- name: CreateSession :one
+INSERT INTO sessions (id, created_at, last_used_at, user_id, user_agent, ip, expires_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: GetActiveSession :one
+SELECT * FROM sessions
+WHERE id = $1 AND revoked_at IS NULL AND expires_at > NOW();
+
+-- name: ListActiveSessions :many
+SELECT * FROM sessions
+WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+ORDER BY last_used_at DESC;
+
+-- name: TouchSession :exec
+UPDATE sessions
+SET last_used_at = NOW()
+WHERE id = $1;
+
+-- name: RevokeSession :execrows
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeUserSessions :exec
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeSessionByRefreshToken :exec
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE id = (SELECT session_id FROM refresh_tokens WHERE token = $1)
+AND revoked_at IS NULL;
@@ -0,0 +1,44 @@
+-- name: GetUserTOTP :one
+SELECT * FROM user_totp
+WHERE user_id = $1;
+
+-- name: UpsertPendingTOTP :one
+INSERT INTO user_totp (user_id, created_at, updated_at, secret)
+VALUES (
+    $1,
+    NOW(),
+    NOW(),
+    $2
+)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, last_step = 0, updated_at = NOW()
+WHERE user_totp.enabled_at IS NULL
+RETURNING *;
+
+-- name: EnableTOTP :execrows
+UPDATE user_totp
+SET enabled_at = NOW(), last_step = $2, updated_at = NOW()
+WHERE user_id = $1 AND enabled_at IS NULL;
+
+-- name: ConsumeTOTPStep :execrows
+UPDATE user_totp
+SET last_step = $2, updated_at = NOW()
+WHERE user_id = $1 AND last_step < $2;
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM totp_recovery_codes
+WHERE user_id = $1;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO totp_recovery_codes (id, created_at, user_id, code_hash)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2
+);
+
+-- name: UseRecoveryCode :execrows
+UPDATE totp_recovery_codes
+SET used_at = NOW()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
@@ -12,3 +12,55 @@ RETURNING *;
 -- name: GetUser :one
 SELECT * FROM users
 WHERE email = $1;
+
+-- name: UpdateUser :one
+UPDATE users
+SET email = $2,
+    hashed_password = $3,
+    email_verified_at = CASE WHEN email = $2 THEN email_verified_at ELSE NULL END,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET hashed_password = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: UpgradeUserToChirpyRed :execrows
+UPDATE users
+SET is_chirpy_red = TRUE, updated_at = NOW()
+WHERE id = $1;
+
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: MarkEmailVerified :execrows
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email = $2;
+
+-- name: ResetUserPassword :execrows
+UPDATE users
+SET hashed_password = $3, updated_at = NOW()
+WHERE id = $1 AND email = $2;
+
+-- name: SetUserRole :one
+UPDATE users
+SET role = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: CreateSSOUser :one
+-- Single sign-on users have no password until they set one through a
+-- password reset; the column default never matches a hash.
+INSERT INTO users (id, created_at, updated_at, email, email_verified_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    NOW()
+)
+RETURNING *;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE refresh_tokens ADD COLUMN revoked_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE refresh_tokens DROP COLUMN revoked_at;
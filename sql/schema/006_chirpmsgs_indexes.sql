@@ -0,0 +1,7 @@
+-- +goose Up
+CREATE INDEX chirpmsgs_created_at_id_idx ON chirpmsgs (created_at, id);
+CREATE INDEX chirpmsgs_user_id_created_at_id_idx ON chirpmsgs (user_id, created_at, id);
+
+-- +goose Down
+DROP INDEX chirpmsgs_user_id_created_at_id_idx;
+DROP INDEX chirpmsgs_created_at_id_idx;
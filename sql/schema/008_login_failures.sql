@@ -0,0 +1,25 @@
+-- +goose Up
+CREATE TABLE login_failures (
+    kind TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    failures INTEGER NOT NULL,
+    last_failure_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP,
+    PRIMARY KEY(kind, subject)
+);
+
+CREATE TABLE lockout_events (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    kind TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    event TEXT NOT NULL,
+    failures INTEGER NOT NULL,
+    locked_until TIMESTAMP,
+    actor_id UUID,
+    FOREIGN KEY(actor_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- +goose Down
+DROP TABLE lockout_events;
+DROP TABLE login_failures;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- Pending single sign-on logins, keyed by the state parameter. Rows are
+-- deleted when the provider redirects back.
+CREATE TABLE oidc_logins (
+    state TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE oidc_logins;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- Maintained alongside follows so the timeline can tell heavily followed
+-- authors apart without counting their followers on every request.
+CREATE TABLE follower_counts (
+    user_id UUID PRIMARY KEY,
+    followers INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO follower_counts (user_id, followers)
+SELECT followee_id, COUNT(*) FROM follows GROUP BY followee_id;
+
+-- +goose Down
+DROP TABLE follower_counts;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Replies outlive the chirp they answer; deleting a chirp detaches its
+-- replies rather than deleting other users' chirps.
+ALTER TABLE chirpmsgs ADD COLUMN reply_to_id UUID REFERENCES chirpmsgs(id) ON DELETE SET NULL;
+CREATE INDEX chirpmsgs_reply_to_id_created_at_id_idx ON chirpmsgs (reply_to_id, created_at, id);
+
+-- +goose Down
+DROP INDEX chirpmsgs_reply_to_id_created_at_id_idx;
+ALTER TABLE chirpmsgs DROP COLUMN reply_to_id;
@@ -0,0 +1,24 @@
+-- +goose Up
+-- A rechirp has no body of its own and goes when the original does. A
+-- quote chirp has its own body and survives the original, losing only the
+-- reference.
+ALTER TABLE chirpmsgs ADD COLUMN rechirp_of_id UUID REFERENCES chirpmsgs(id) ON DELETE CASCADE;
+ALTER TABLE chirpmsgs ADD COLUMN quote_of_id UUID REFERENCES chirpmsgs(id) ON DELETE SET NULL;
+ALTER TABLE chirpmsgs ADD CONSTRAINT chirpmsgs_rechirp_check
+    CHECK (rechirp_of_id IS NULL OR (body = '' AND reply_to_id IS NULL AND quote_of_id IS NULL));
+
+-- Rechirps all share the empty body, so only authored chirps need unique
+-- bodies.
+ALTER TABLE chirpmsgs DROP CONSTRAINT chirpmsgs_body_key;
+CREATE UNIQUE INDEX chirpmsgs_body_key ON chirpmsgs (body) WHERE rechirp_of_id IS NULL;
+
+CREATE UNIQUE INDEX chirpmsgs_user_id_rechirp_of_id_idx ON chirpmsgs (user_id, rechirp_of_id) WHERE rechirp_of_id IS NOT NULL;
+
+-- +goose Down
+DELETE FROM chirpmsgs WHERE rechirp_of_id IS NOT NULL;
+DROP INDEX chirpmsgs_user_id_rechirp_of_id_idx;
+DROP INDEX chirpmsgs_body_key;
+ALTER TABLE chirpmsgs ADD CONSTRAINT chirpmsgs_body_key UNIQUE (body);
+ALTER TABLE chirpmsgs DROP CONSTRAINT chirpmsgs_rechirp_check;
+ALTER TABLE chirpmsgs DROP COLUMN quote_of_id;
+ALTER TABLE chirpmsgs DROP COLUMN rechirp_of_id;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- Chirps that were not pushed onto followers' cached timelines because
+-- their author had too many followers when they were posted. Timeline
+-- reads merge these in, whatever the author's follower count is now.
+CREATE TABLE fanout_skips (
+    chirp_id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    FOREIGN KEY(chirp_id) REFERENCES chirpmsgs(id) ON DELETE CASCADE
+);
+
+CREATE INDEX fanout_skips_user_id_created_at_idx ON fanout_skips (user_id, created_at DESC, chirp_id DESC);
+
+-- +goose Down
+DROP TABLE fanout_skips;
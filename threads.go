@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/deoreal/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// ThreadNode is a chirp together with the replies to it, oldest first.
+type ThreadNode struct {
+	Chirp
+	Replies []ThreadNode `json:"replies"`
+}
+
+type Thread struct {
+	// Ancestors runs from the root of the conversation down to the
+	// chirp's direct parent.
+	Ancestors []Chirp    `json:"ancestors"`
+	Chirp     ThreadNode `json:"chirp"`
+}
+
+// buildReplyTree nests descendants, which must be ordered oldest first,
+// under root.
+func buildReplyTree(root Chirp, descendants []Chirp) ThreadNode {
+	children := map[uuid.UUID][]Chirp{}
+	for _, c := range descendants {
+		if c.ReplyToID != nil {
+			children[*c.ReplyToID] = append(children[*c.ReplyToID], c)
+		}
+	}
+
+	var build func(c Chirp) ThreadNode
+	build = func(c Chirp) ThreadNode {
+		node := ThreadNode{Chirp: c, Replies: []ThreadNode{}}
+		for _, child := range children[c.ID] {
+			node.Replies = append(node.Replies, build(child))
+		}
+		return node
+	}
+	return build(root)
+}
+
+// getThread returns a chirp with the chain of chirps it replies to and
+// every reply beneath it.
+func (cfg *apiConfig) getThread(w http.ResponseWriter, req *http.Request) {
+	chirpID, err := uuid.Parse(req.PathValue("chirpID"))
+	if err != nil {
+		w.WriteHeader(404)
+		js, _ := json.Marshal(jsonError{Error: "Chirp not found"})
+		w.Write(js)
+		return
+	}
+
+	dbChirp, err := cfg.dbQueries.GetChirpById(req.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(404)
+			js, _ := json.Marshal(jsonError{Error: "Chirp not found"})
+			w.Write(js)
+			return
+		}
+		log.Printf("Error db query %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	dbAncestors, err := cfg.dbQueries.ListChirpAncestors(req.Context(), chirpID)
+	if err != nil {
+		log.Printf("Error db query %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+	dbDescendants, err := cfg.dbQueries.ListChirpDescendants(req.Context(), uuid.NullUUID{UUID: chirpID, Valid: true})
+	if err != nil {
+		log.Printf("Error db query %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	// Annotate every chirp in the thread with a single query.
+	chirps := make([]Chirp, 0, len(dbAncestors)+1+len(dbDescendants))
+	for _, a := range dbAncestors {
+		chirps = append(chirps, chirpFromDB(database.Chirpmsg(a)))
+	}
+	chirps = append(chirps, chirpFromDB(dbChirp))
+	for _, d := range dbDescendants {
+		chirps = append(chirps, chirpFromDB(database.Chirpmsg(d)))
+	}
+	if err := cfg.annotateChirps(req.Context(), chirps); err != nil {
+		log.Printf("Error db query %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	n := len(dbAncestors)
+	thread := Thread{
+		Ancestors: chirps[:n],
+		Chirp:     buildReplyTree(chirps[n], chirps[n+1:]),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	js, _ := json.Marshal(thread)
+	w.Write(js)
+}
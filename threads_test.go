@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestBuildReplyTree(t *testing.T) {
+	reply := func(parent Chirp) Chirp {
+		return Chirp{ID: uuid.New(), ReplyToID: &parent.ID}
+	}
+	root := Chirp{ID: uuid.New()}
+	a := reply(root)
+	b := reply(root)
+	a1 := reply(a)
+	a1x := reply(a1)
+
+	tree := buildReplyTree(root, []Chirp{a, b, a1, a1x})
+
+	if tree.ID != root.ID || len(tree.Replies) != 2 {
+		t.Fatalf("root has %d replies, want 2", len(tree.Replies))
+	}
+	if tree.Replies[0].ID != a.ID || tree.Replies[1].ID != b.ID {
+		t.Errorf("replies out of order")
+	}
+	if got := tree.Replies[0].Replies; len(got) != 1 || got[0].ID != a1.ID {
+		t.Fatalf("a's replies = %v, want [a1]", got)
+	}
+	if got := tree.Replies[0].Replies[0].Replies; len(got) != 1 || got[0].ID != a1x.ID {
+		t.Errorf("a1's replies = %v, want [a1x]", got)
+	}
+	if tree.Replies[1].Replies == nil {
+		t.Errorf("leaf replies should be empty, not nil, so they encode as []")
+	}
+}
+
+func TestGetThread(t *testing.T) {
+	cfg := newDBConfig(t)
+	alice := createTestUser(t, cfg, "alice@example.com")
+	bob := createTestUser(t, cfg, "bob@example.com")
+
+	post := func(userID uuid.UUID, body string, replyTo *Chirp) Chirp {
+		t.Helper()
+		msg := ChirpyMessage{Body: body}
+		if replyTo != nil {
+			msg.ReplyToID = &replyTo.ID
+		}
+		chirp, code := postChirp(t, cfg, userID, msg)
+		if code != 201 {
+			t.Fatalf("addChirp(%q) status = %d, want 201", body, code)
+		}
+		return chirp
+	}
+	root := post(alice, "root", nil)
+	a := post(bob, "a", &root)
+	b := post(alice, "b", &root)
+	a1 := post(alice, "a1", &a)
+	a1x := post(bob, "a1x", &a1)
+
+	if _, code := postChirp(t, cfg, alice, ChirpyMessage{Body: "orphan", ReplyToID: &uuid.Nil}); code != 400 {
+		t.Errorf("replying to a missing chirp: status = %d, want 400", code)
+	}
+
+	getThread := func(id uuid.UUID) (Thread, int) {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/api/chirps/x/thread", nil)
+		req.SetPathValue("chirpID", id.String())
+		rec := httptest.NewRecorder()
+		cfg.getThread(rec, req)
+		var thread Thread
+		if rec.Code == 200 {
+			if err := json.Unmarshal(rec.Body.Bytes(), &thread); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return thread, rec.Code
+	}
+
+	thread, code := getThread(a1.ID)
+	if code != 200 {
+		t.Fatalf("getThread status = %d, want 200", code)
+	}
+	if len(thread.Ancestors) != 2 || thread.Ancestors[0].ID != root.ID || thread.Ancestors[1].ID != a.ID {
+		t.Errorf("ancestors = %v, want [root a]", thread.Ancestors)
+	}
+	if thread.Ancestors[0].ReplyCount != 2 || thread.Ancestors[1].ReplyCount != 1 {
+		t.Errorf("ancestor reply counts = %d, %d; want 2, 1", thread.Ancestors[0].ReplyCount, thread.Ancestors[1].ReplyCount)
+	}
+	if thread.Chirp.ID != a1.ID || len(thread.Chirp.Replies) != 1 || thread.Chirp.Replies[0].ID != a1x.ID {
+		t.Errorf("chirp = %v with replies %v, want a1 with [a1x]", thread.Chirp.ID, thread.Chirp.Replies)
+	}
+
+	thread, _ = getThread(root.ID)
+	if len(thread.Ancestors) != 0 || len(thread.Chirp.Replies) != 2 || thread.Chirp.Replies[0].ID != a.ID || thread.Chirp.Replies[1].ID != b.ID {
+		t.Errorf("root thread = %+v, want replies [a b] and no ancestors", thread)
+	}
+
+	if _, code := getThread(uuid.New()); code != 404 {
+		t.Errorf("unknown chirp: status = %d, want 404", code)
+	}
+
+	// Deleting a chirp detaches its replies instead of deleting them.
+	if err := cfg.dbQueries.DeleteChirp(context.Background(), root.ID); err != nil {
+		t.Fatal(err)
+	}
+	thread, code = getThread(a.ID)
+	if code != 200 || len(thread.Ancestors) != 0 || thread.Chirp.ReplyToID != nil {
+		t.Errorf("after deleting root, thread of a = %d %+v; want a with no parent", code, thread)
+	}
+}
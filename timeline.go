@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/deoreal/chirpy/internal/database"
+	"github.com/deoreal/chirpy/internal/timeline"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultTimelineCacheUsers   = 10000
+	defaultTimelineCacheEntries = 500
+	defaultFanoutLimit          = 1000
+	fanoutTimeout               = 30 * time.Second
+)
+
+// loadTimelineCache reads the timeline cache settings. Setting
+// TIMELINE_CACHE_USERS to 0 disables the cache, leaving every timeline
+// read to the database.
+func loadTimelineCache(getenv func(string) string) (*timeline.Cache, int, error) {
+	users, entries, fanout := defaultTimelineCacheUsers, defaultTimelineCacheEntries, defaultFanoutLimit
+	for _, v := range []struct {
+		name string
+		dst  *int
+	}{
+		{"TIMELINE_CACHE_USERS", &users},
+		{"TIMELINE_CACHE_ENTRIES", &entries},
+		{"TIMELINE_FANOUT_LIMIT", &fanout},
+	} {
+		if s := getenv(v.name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				return nil, 0, fmt.Errorf("invalid %s %q", v.name, s)
+			}
+			*v.dst = n
+		}
+	}
+	if users == 0 {
+		return nil, fanout, nil
+	}
+	if entries == 0 {
+		return nil, 0, fmt.Errorf("invalid TIMELINE_CACHE_ENTRIES %q", getenv("TIMELINE_CACHE_ENTRIES"))
+	}
+
+	return timeline.NewCache(users, entries), fanout, nil
+}
+
+// fanOut pushes a new chirp onto the cached timelines of its author and
+// their followers. The author's own timeline is updated before returning so
+// they see their chirp straight away; followers are updated in the
+// background. Chirps by authors with more than FanoutLimit followers are
+// recorded as skipped instead, and merged in at read time.
+func (cfg *apiConfig) fanOut(chr database.Chirpmsg) {
+	if cfg.Timelines == nil {
+		return
+	}
+	e := timeline.Entry{ChirpID: chr.ID, AuthorID: chr.UserID, CreatedAt: chr.CreatedAt}
+	cfg.Timelines.Push(chr.UserID, e)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), fanoutTimeout)
+		defer cancel()
+
+		followers, err := cfg.dbQueries.GetFollowerCount(ctx, chr.UserID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error db query %s", err)
+			return
+		}
+		if int(followers) > cfg.FanoutLimit {
+			err := cfg.dbQueries.RecordFanoutSkip(ctx, database.RecordFanoutSkipParams{
+				ChirpID:   chr.ID,
+				UserID:    chr.UserID,
+				CreatedAt: chr.CreatedAt,
+			})
+			if err != nil {
+				log.Printf("Error db query %s", err)
+			}
+			return
+		}
+		followerIDs, err := cfg.dbQueries.ListFollowerIDs(ctx, chr.UserID)
+		if err != nil {
+			log.Printf("Error db query %s", err)
+			return
+		}
+		for _, id := range followerIDs {
+			cfg.Timelines.Push(id, e)
+		}
+	}()
+}
+
+// timelineEntries returns up to limit entries of userID's home timeline
+// older than cursor. Cached timelines only hold chirps that were fanned out
+// on write, so chirps fanOut skipped are read separately and merged in.
+// Anything the cache cannot answer is read from the database.
+func (cfg *apiConfig) timelineEntries(ctx context.Context, userID uuid.UUID, cursor *chirpCursor, limit int32) ([]timeline.Entry, error) {
+	var after *timeline.Entry
+	if cursor != nil {
+		after = &timeline.Entry{ChirpID: cursor.ID, CreatedAt: cursor.CreatedAt}
+	}
+
+	if cfg.Timelines != nil {
+		cached, ok := cfg.Timelines.Page(userID, after, int(limit))
+		if !ok && cursor == nil {
+			cfg.Timelines.BeginFill(userID)
+			dbChirps, err := cfg.dbQueries.ListTimeline(ctx, database.ListTimelineParams{ViewerID: userID, RowLimit: int32(cfg.Timelines.MaxEntries())})
+			if err != nil {
+				cfg.Timelines.CancelFill(userID)
+				return nil, err
+			}
+			cfg.Timelines.Fill(userID, entriesFromDB(dbChirps))
+			cached, ok = cfg.Timelines.Page(userID, after, int(limit))
+		}
+		if ok {
+			args := database.ListFanoutSkipsParams{FollowerID: userID, RowLimit: limit}
+			if cursor != nil {
+				args.CursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+				args.CursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+			}
+			skipped, err := cfg.dbQueries.ListFanoutSkips(ctx, args)
+			if err != nil {
+				return nil, err
+			}
+			if len(skipped) == 0 {
+				return cached, nil
+			}
+			skippedEntries := make([]timeline.Entry, 0, len(skipped))
+			for _, s := range skipped {
+				skippedEntries = append(skippedEntries, timeline.Entry{ChirpID: s.ChirpID, AuthorID: s.UserID, CreatedAt: s.CreatedAt})
+			}
+			return timeline.Merge(int(limit), cached, skippedEntries), nil
+		}
+	}
+
+	args := database.ListTimelineParams{ViewerID: userID, RowLimit: limit}
+	if cursor != nil {
+		args.CursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		args.CursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+	dbChirps, err := cfg.dbQueries.ListTimeline(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	return entriesFromDB(dbChirps), nil
+}
+
+func entriesFromDB(chirps []database.Chirpmsg) []timeline.Entry {
+	entries := make([]timeline.Entry, 0, len(chirps))
+	for _, c := range chirps {
+		entries = append(entries, timeline.Entry{ChirpID: c.ID, AuthorID: c.UserID, CreatedAt: c.CreatedAt})
+	}
+	return entries
+}
+
+// getTimeline returns the caller's home timeline: their own chirps and
+// those of everyone they follow, newest first.
+func (cfg *apiConfig) getTimeline(w http.ResponseWriter, req *http.Request) {
+	type chirpPage struct {
+		Chirps     []Chirp `json:"chirps"`
+		NextCursor string  `json:"next_cursor,omitempty"`
+	}
+
+	userID, _ := userIDFromContext(req.Context())
+	limit, cursor, err := parsePageParams(req.URL.Query())
+	if err != nil {
+		w.WriteHeader(400)
+		js, _ := json.Marshal(jsonError{Error: err.Error()})
+		w.Write(js)
+		return
+	}
+
+	// Fetch one extra entry to learn whether another page follows.
+	entries, err := cfg.timelineEntries(req.Context(), userID, cursor, limit+1)
+	if err != nil {
+		log.Printf("Error db query %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	page := chirpPage{Chirps: []Chirp{}}
+	if len(entries) > int(limit) {
+		entries = entries[:limit]
+		last := entries[len(entries)-1]
+		page.NextCursor = chirpCursor{CreatedAt: last.CreatedAt, ID: last.ChirpID}.encode()
+	}
+
+	ids := make([]uuid.UUID, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.ChirpID)
+	}
+	dbChirps, err := cfg.dbQueries.GetChirpsByIDs(req.Context(), ids)
+	if err != nil {
+		log.Printf("Error db query %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+	byID := make(map[uuid.UUID]database.Chirpmsg, len(dbChirps))
+	for _, c := range dbChirps {
+		byID[c.ID] = c
+	}
+	// Cached entries may name chirps deleted since; skip them.
+	for _, e := range entries {
+		if c, ok := byID[e.ChirpID]; ok {
+			page.Chirps = append(page.Chirps, chirpFromDB(c))
+		}
+	}
+	if err := cfg.annotateChirps(req.Context(), page.Chirps); err != nil {
+		log.Printf("Error db query %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	js, _ := json.Marshal(page)
+	w.Write(js)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/deoreal/chirpy/internal/database"
+	"github.com/deoreal/chirpy/internal/timeline"
+	"github.com/google/uuid"
+)
+
+func TestLoadTimelineCache(t *testing.T) {
+	env := func(m map[string]string) func(string) string {
+		return func(k string) string { return m[k] }
+	}
+
+	cache, fanout, err := loadTimelineCache(env(nil))
+	if err != nil {
+		t.Fatalf("defaults: %v", err)
+	}
+	if cache == nil || cache.MaxEntries() != defaultTimelineCacheEntries || fanout != defaultFanoutLimit {
+		t.Errorf("defaults = %v, %d", cache, fanout)
+	}
+
+	cache, fanout, err = loadTimelineCache(env(map[string]string{
+		"TIMELINE_CACHE_ENTRIES": "50",
+		"TIMELINE_FANOUT_LIMIT":  "10",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache.MaxEntries() != 50 || fanout != 10 {
+		t.Errorf("MaxEntries = %d, fanout = %d; want 50, 10", cache.MaxEntries(), fanout)
+	}
+
+	cache, _, err = loadTimelineCache(env(map[string]string{"TIMELINE_CACHE_USERS": "0"}))
+	if err != nil || cache != nil {
+		t.Errorf("TIMELINE_CACHE_USERS=0: cache = %v, err = %v; want disabled", cache, err)
+	}
+
+	for _, bad := range []map[string]string{
+		{"TIMELINE_CACHE_USERS": "lots"},
+		{"TIMELINE_CACHE_ENTRIES": "0"},
+		{"TIMELINE_FANOUT_LIMIT": "-1"},
+	} {
+		if _, _, err := loadTimelineCache(env(bad)); err == nil {
+			t.Errorf("%v: want error", bad)
+		}
+	}
+}
+
+// readTimeline returns the IDs on the first page of userID's timeline.
+func readTimeline(t *testing.T, cfg *apiConfig, userID uuid.UUID) []uuid.UUID {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	cfg.getTimeline(rec, requestAs(userID, "GET", "/api/timeline", ""))
+	if rec.Code != 200 {
+		t.Fatalf("getTimeline status = %d: %s", rec.Code, rec.Body)
+	}
+	var page struct {
+		Chirps []Chirp `json:"chirps"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	var ids []uuid.UUID
+	for _, c := range page.Chirps {
+		ids = append(ids, c.ID)
+	}
+	return ids
+}
+
+func TestTimelineKeepsChirpsSkippedByFanout(t *testing.T) {
+	cfg := newDBConfig(t)
+	cfg.Timelines = timeline.NewCache(10, 100)
+	cfg.FanoutLimit = 0
+	ctx := context.Background()
+
+	reader := createTestUser(t, cfg, "reader@example.com")
+	author := createTestUser(t, cfg, "author@example.com")
+	if err := cfg.follow(ctx, reader, author); err != nil {
+		t.Fatalf("follow() error = %v", err)
+	}
+	if got := readTimeline(t, cfg, reader); len(got) != 0 {
+		t.Fatalf("timeline = %v, want empty", got)
+	}
+
+	// With one follower the author is over the limit, so fanOut skips
+	// the reader's cached timeline.
+	rec := httptest.NewRecorder()
+	cfg.addChirp(rec, requestAs(author, "POST", "/api/chirps", `{"body": "hello"}`))
+	if rec.Code != 201 {
+		t.Fatalf("addChirp status = %d: %s", rec.Code, rec.Body)
+	}
+	var chirp Chirp
+	json.Unmarshal(rec.Body.Bytes(), &chirp)
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		skips, err := cfg.dbQueries.ListFanoutSkips(ctx, database.ListFanoutSkipsParams{FollowerID: reader, RowLimit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(skips) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("fanOut did not record the skipped chirp")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The author is no longer heavily followed by read time; the chirp
+	// must still be merged in.
+	cfg.FanoutLimit = 10
+	if got := readTimeline(t, cfg, reader); len(got) != 1 || got[0] != chirp.ID {
+		t.Errorf("timeline = %v, want [%v]", got, chirp.ID)
+	}
+}
+
+// BenchmarkTimelineEntries compares reading the first page of a home
+// timeline with the ListTimeline join against reading it from a warm cache.
+func BenchmarkTimelineEntries(b *testing.B) {
+	const authorChirps = 20
+	cfg := newDBConfig(b)
+	ctx := context.Background()
+
+	for _, following := range []int{10, 100} {
+		reader := createTestUser(b, cfg, fmt.Sprintf("reader%d@example.com", following))
+		for i := range following {
+			author := createTestUser(b, cfg, fmt.Sprintf("author%d-%d@example.com", following, i))
+			if err := cfg.follow(ctx, reader, author); err != nil {
+				b.Fatal(err)
+			}
+			for range authorChirps {
+				if _, err := cfg.dbQueries.CreateChirp(ctx, database.CreateChirpParams{Body: "chirp", UserID: author}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+
+		b.Run(fmt.Sprintf("database/following=%d", following), func(b *testing.B) {
+			cfg.Timelines = nil
+			for b.Loop() {
+				if _, err := cfg.timelineEntries(ctx, reader, nil, 20); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("cache/following=%d", following), func(b *testing.B) {
+			cfg.Timelines = timeline.NewCache(1, defaultTimelineCacheEntries)
+			for b.Loop() {
+				if _, err := cfg.timelineEntries(ctx, reader, nil, 20); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/deoreal/chirpy/internal/auth"
+	"github.com/deoreal/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	totpIssuer             = "Chirpy"
+	totpRecoveryCodes      = 10
+	twoFactorAudience      = "chirpy-2fa"
+	twoFactorChallengeTime = 5 * time.Minute
+)
+
+// writeTwoFactorChallenge answers a correct password for a user with 2FA
+// enabled. The challenge token is not an access token; it can only be
+// redeemed at POST /api/login/2fa together with a valid code.
+func (cfg *apiConfig) writeTwoFactorChallenge(w http.ResponseWriter, userID uuid.UUID) {
+	type challengeResponse struct {
+		TwoFactorRequired bool   `json:"two_factor_required"`
+		ChallengeToken    string `json:"challenge_token"`
+	}
+
+	ct, err := cfg.JWTKeys.MakeAudienceJWT(userID, twoFactorAudience, twoFactorChallengeTime)
+	if err != nil {
+		log.Printf("Error creating challenge token %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	js, _ := json.Marshal(challengeResponse{TwoFactorRequired: true, ChallengeToken: ct})
+	w.Write(js)
+}
+
+// twoFactorEnabled reports whether userID must pass a second factor to
+// complete a login.
+func (cfg *apiConfig) twoFactorEnabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	totp, err := cfg.dbQueries.GetUserTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return totp.EnabledAt.Valid, nil
+}
+
+func (cfg *apiConfig) loginTwoFactor(w http.ResponseWriter, req *http.Request) {
+	type twoFactorRequest struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+		Expiration     int    `json:"expires_in_seconds,omitempty"`
+	}
+
+	var tr twoFactorRequest
+	decoder := json.NewDecoder(req.Body)
+	err := decoder.Decode(&tr)
+	if err != nil || (tr.Code == "" && tr.RecoveryCode == "") {
+		log.Printf("Error decoding json parameters: %v", err)
+		w.WriteHeader(400)
+		js, _ := json.Marshal(jsonError{Error: "Invalid request body"})
+		w.Write(js)
+		return
+	}
+	if tr.Expiration == 0 || tr.Expiration >= 3600 {
+		tr.Expiration = 3600
+	}
+
+	userID, err := cfg.JWTKeys.ValidateAudienceJWT(tr.ChallengeToken, twoFactorAudience)
+	if err != nil {
+		log.Printf("Invalid challenge token %s", err)
+		w.WriteHeader(401)
+		js, _ := json.Marshal(jsonError{Error: "Unauthorized"})
+		w.Write(js)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting user: %s", err)
+		w.WriteHeader(401)
+		js, _ := json.Marshal(jsonError{Error: "Unauthorized"})
+		w.Write(js)
+		return
+	}
+
+	ip := clientIP(req, cfg.TrustedProxies)
+	wait, err := cfg.loginRetryAfter(req.Context(), user.Email, ip)
+	if err != nil {
+		log.Printf("Error checking login failures: %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		w.WriteHeader(429)
+		js, _ := json.Marshal(jsonError{Error: "Too many failed login attempts"})
+		w.Write(js)
+		return
+	}
+
+	ok, err := cfg.checkSecondFactor(req, userID, tr.Code, tr.RecoveryCode)
+	if err != nil {
+		log.Printf("Error checking second factor %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+	if !ok {
+		cfg.recordLoginFailure(req.Context(), user.Email, ip)
+		w.WriteHeader(401)
+		js, _ := json.Marshal(jsonError{Error: "Invalid two-factor code"})
+		w.Write(js)
+		return
+	}
+
+	cfg.clearLoginFailures(req.Context(), user.Email)
+	cfg.issueLoginTokens(w, req, user, time.Duration(tr.Expiration)*time.Second)
+}
+
+// checkSecondFactor accepts either a TOTP code, which must be newer than
+// the last one used, or an unused recovery code, which is consumed.
+func (cfg *apiConfig) checkSecondFactor(req *http.Request, userID uuid.UUID, code, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		n, err := cfg.dbQueries.UseRecoveryCode(req.Context(), database.UseRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: auth.HashRecoveryCode(recoveryCode),
+		})
+		return n == 1, err
+	}
+
+	totp, err := cfg.dbQueries.GetUserTOTP(req.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !totp.EnabledAt.Valid) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	n, err := cfg.dbQueries.ConsumeTOTPStep(req.Context(), database.ConsumeTOTPStepParams{UserID: userID, LastStep: step})
+
+	return n == 1, err
+}
+
+func (cfg *apiConfig) enrollTOTP(w http.ResponseWriter, req *http.Request) {
+	type enrollResponse struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}
+
+	userID, _ := userIDFromContext(req.Context())
+
+	user, err := cfg.dbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting user: %s", err)
+		w.WriteHeader(401)
+		js, _ := json.Marshal(jsonError{Error: "Unauthorized"})
+		w.Write(js)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		log.Printf("Error generating totp secret %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	_, err = cfg.dbQueries.UpsertPendingTOTP(req.Context(), database.UpsertPendingTOTPParams{UserID: userID, Secret: secret})
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(409)
+		js, _ := json.Marshal(jsonError{Error: "Two-factor authentication is already enabled"})
+		w.Write(js)
+		return
+	}
+	if err != nil {
+		log.Printf("Error storing totp secret %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(201)
+	js, _ := json.Marshal(enrollResponse{Secret: secret, OTPAuthURI: auth.TOTPURI(secret, totpIssuer, user.Email)})
+	w.Write(js)
+}
+
+func (cfg *apiConfig) verifyTOTP(w http.ResponseWriter, req *http.Request) {
+	type verifyRequest struct {
+		Code string `json:"code"`
+	}
+	type verifyResponse struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	userID, _ := userIDFromContext(req.Context())
+
+	var vr verifyRequest
+	decoder := json.NewDecoder(req.Body)
+	err := decoder.Decode(&vr)
+	if err != nil {
+		log.Printf("Error decoding json parameters: %s", err)
+		w.WriteHeader(400)
+		js, _ := json.Marshal(jsonError{Error: "Invalid request body"})
+		w.Write(js)
+		return
+	}
+
+	totp, err := cfg.dbQueries.GetUserTOTP(req.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(404)
+		js, _ := json.Marshal(jsonError{Error: "No pending two-factor enrollment"})
+		w.Write(js)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading two-factor settings %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+	if totp.EnabledAt.Valid {
+		w.WriteHeader(409)
+		js, _ := json.Marshal(jsonError{Error: "Two-factor authentication is already enabled"})
+		w.Write(js)
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, vr.Code, time.Now())
+	if !ok {
+		w.WriteHeader(401)
+		js, _ := json.Marshal(jsonError{Error: "Invalid two-factor code"})
+		w.Write(js)
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(totpRecoveryCodes)
+	if err != nil {
+		log.Printf("Error generating recovery codes %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	err = cfg.enableTOTP(req, userID, step, codes)
+	if err != nil {
+		log.Printf("Error enabling two-factor authentication %s", err)
+		w.WriteHeader(500)
+		js, _ := json.Marshal(jsonError{Error: "Something went wrong"})
+		w.Write(js)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	js, _ := json.Marshal(verifyResponse{RecoveryCodes: codes})
+	w.Write(js)
+}
+
+// enableTOTP activates the pending secret and replaces the recovery codes
+// in one transaction.
+func (cfg *apiConfig) enableTOTP(req *http.Request, userID uuid.UUID, step int64, codes []string) error {
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	n, err := qtx.EnableTOTP(req.Context(), database.EnableTOTPParams{UserID: userID, LastStep: step})
+	if err != nil {
+		return err
+	}
+	if n != 1 {
+		return errors.New("two-factor enrollment changed concurrently")
+	}
+	if err := qtx.DeleteRecoveryCodes(req.Context(), userID); err != nil {
+		return err
+	}
+	for _, code := range codes {
+		err := qtx.CreateRecoveryCode(req.Context(), database.CreateRecoveryCodeParams{UserID: userID, CodeHash: auth.HashRecoveryCode(code)})
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestTwoFactorChallengeIsNotAnAccessToken(t *testing.T) {
+	keys, err := loadKeyring("", "", "", "test_secret_key")
+	if err != nil {
+		t.Fatalf("loadKeyring() error = %v", err)
+	}
+	cfg := &apiConfig{JWTKeys: keys}
+
+	rec := httptest.NewRecorder()
+	cfg.writeTwoFactorChallenge(rec, uuid.New())
+	if rec.Code != 200 {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var body struct {
+		TwoFactorRequired bool   `json:"two_factor_required"`
+		ChallengeToken    string `json:"challenge_token"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode body: %v", err)
+	}
+	if !body.TwoFactorRequired || body.ChallengeToken == "" {
+		t.Fatalf("unexpected challenge response %s", rec.Body.String())
+	}
+
+	called := false
+	h := cfg.middlewareTokenAuth(func(w http.ResponseWriter, r *http.Request) { called = true })
+	req := httptest.NewRequest("POST", "/api/chirps", nil)
+	req.Header.Set("Authorization", "Bearer "+body.ChallengeToken)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != 401 || called {
+		t.Errorf("challenge token was accepted as an access token (status %d)", rec.Code)
+	}
+}
+
+func TestLoginTwoFactorRejectsAccessToken(t *testing.T) {
+	keys, err := loadKeyring("", "", "", "test_secret_key")
+	if err != nil {
+		t.Fatalf("loadKeyring() error = %v", err)
+	}
+	cfg := &apiConfig{JWTKeys: keys}
+
+	access, err := keys.MakeJWT(uuid.New(), "user", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/api/login/2fa", strings.NewReader(`{"challenge_token":"`+access+`","code":"123456"}`))
+	rec := httptest.NewRecorder()
+	cfg.loginTwoFactor(rec, req)
+
+	if rec.Code != 401 {
+		t.Errorf("status = %d, want 401", rec.Code)
+	}
+}